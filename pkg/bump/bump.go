@@ -0,0 +1,116 @@
+// Package bump updates the tags of the images in an environment to the
+// newest tags in their registries.
+package bump
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+	"github.com/bigkevmcd/peanut/pkg/registry"
+)
+
+// Bump is the result of bumping an image.
+//
+// Images are the image overrides written to the environment's kustomization
+// at Path, it's empty if the image already has the selected tag.
+type Bump struct {
+	App         string                `json:"app"`
+	Environment string                `json:"environment"`
+	Path        string                `json:"path"`
+	Images      []*config.ImageChange `json:"images"`
+}
+
+// Image selects the newest tag of an image that's rendered in an environment,
+// and writes an image override with the tag to the environment's
+// kustomization.
+//
+// The name identifies the image without a tag, e.g. "redis" or
+// "quay.io/my-org/api", and the tags are read from the image's registry. The
+// environment is rendered after the override is written, and it's an error if
+// it doesn't render the bumped image.
+func Image(ctx context.Context, app *config.App, files filesys.FileSystem, env, name string, r registry.Registry, policy registry.Policy) (*Bump, error) {
+	e := app.Environment(env)
+	if e == nil {
+		return nil, fmt.Errorf("unknown environment %q in app %s", env, app.Name)
+	}
+	want, err := image.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := config.ParseManifestsFromFileSystem(app, files, plumbing.ZeroHash)
+	if err != nil {
+		return nil, err
+	}
+	container := renderedContainer(desired.App(app.Name), env, want)
+	if container == nil {
+		return nil, fmt.Errorf("image %s isn't used in environment %s of app %s", name, env, app.Name)
+	}
+	current := container.Image
+	tag, err := policy.Select(ctx, r, current)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, kz, err := kustomize.ReadKustomization(files, e.Path())
+	if err != nil {
+		return nil, err
+	}
+	b := &Bump{App: app.Name, Environment: env, Path: filename, Images: []*config.ImageChange{}}
+	if tag == current.Tag && current.Digest == "" {
+		return b, nil
+	}
+	k := kz.Kustomization()
+	if err := kz.AddImageOverride(kustomize.OverrideName(k, container.ImageName), tag); err != nil {
+		return nil, err
+	}
+	if err := kustomize.WriteKustomization(files, filename, kz); err != nil {
+		return nil, err
+	}
+	bumped := image.Reference{Registry: current.Registry, Repository: current.Repository, Tag: tag}
+	if err := kustomize.CheckImages(files, e.Path(), bumped); err != nil {
+		return nil, err
+	}
+	b.Images = append(b.Images, &config.ImageChange{Name: current.Name(), From: &current, To: &bumped})
+	return b, nil
+}
+
+// Message returns a commit message that lists the bumped images.
+func (b *Bump) Message() string {
+	var s strings.Builder
+	if len(b.Images) == 1 {
+		c := b.Images[0]
+		name := image.Reference{Registry: c.To.Registry, Repository: c.To.Repository}.Familiar()
+		fmt.Fprintf(&s, "Bump %s to %s in %s\n\n", name, c.To.Tag, b.Environment)
+	} else {
+		fmt.Fprintf(&s, "Bump images in %s\n\n", b.Environment)
+	}
+	fmt.Fprintf(&s, "Updates the images in the %s environment of %s:\n\n", b.Environment, b.App)
+	for _, c := range b.Images {
+		fmt.Fprintf(&s, "- %s -> %s\n", c.From.Familiar(), c.To.Familiar())
+	}
+	return s.String()
+}
+
+// renderedContainer returns the first long-running container in an
+// environment with an image with the same name as the wanted image.
+func renderedContainer(state *config.AppState, env string, want image.Reference) *parser.Container {
+	if state == nil || state.Environment(env) == nil {
+		return nil
+	}
+	for _, svc := range state.Environment(env).Services {
+		for _, c := range svc.Containers {
+			if (c.Role == parser.RoleMain || c.Role == parser.RoleSidecar) && c.Image.Name() == want.Name() {
+				return c
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package bump
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/internal/demotest"
+	"github.com/bigkevmcd/peanut/pkg/registry"
+)
+
+func TestImage(t *testing.T) {
+	files := demotest.Files()
+	r := testRegistry{"example.com/http": {"v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0"}}
+
+	b, err := Image(context.Background(), demotest.App(), files, "production", "example.com/http", r, registry.Policy{Semver: "<2.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Bump{
+		App:         "demo",
+		Environment: "production",
+		Path:        "demo/overlays/production/kustomization.yaml",
+		Images:      []*config.ImageChange{demotest.ImageChange("example.com/http", "example.com/http:v1.0.0", "example.com/http:v1.2.0")},
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Fatalf("failed to bump:\n%s", diff)
+	}
+	changes, err := files.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := []gitfs.Change{{Path: want.Path, Contents: []byte(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: production
+resources:
+- ../../base
+images:
+- name: example.com/http
+  newName: example.com/http
+  newTag: v1.2.0
+`)}}
+	if diff := cmp.Diff(wantChanges, changes); diff != "" {
+		t.Fatalf("failed to write the kustomization:\n%s", diff)
+	}
+}
+
+func TestImageAddsOverride(t *testing.T) {
+	files := demotest.Files()
+	r := testRegistry{"docker.io/library/redis": {"6-alpine", "6.2-alpine", "7-alpine"}}
+
+	b, err := Image(context.Background(), demotest.App(), files, "production", "redis", r, registry.Policy{Filter: "^6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*config.ImageChange{demotest.ImageChange("docker.io/library/redis", "redis:6-alpine", "redis:6.2-alpine")}
+	if diff := cmp.Diff(want, b.Images); diff != "" {
+		t.Fatalf("failed to bump:\n%s", diff)
+	}
+	written, err := files.ReadFile(b.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "- name: redis\n  newTag: 6.2-alpine\n") {
+		t.Fatalf("the kustomization has no override for redis:\n%s", written)
+	}
+}
+
+func TestImageWithFullyQualifiedImage(t *testing.T) {
+	files := demotest.Files()
+	r := testRegistry{"docker.io/library/busybox": {"1.36", "1.37"}}
+
+	b, err := Image(context.Background(), demotest.App(), files, "production", "busybox", r, registry.Policy{Semver: ">=1.0.0 <2.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*config.ImageChange{demotest.ImageChange("docker.io/library/busybox", "busybox:1.36", "busybox:1.37")}
+	if diff := cmp.Diff(want, b.Images); diff != "" {
+		t.Fatalf("failed to bump:\n%s", diff)
+	}
+	written, err := files.ReadFile(b.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "- name: docker.io/library/busybox\n  newTag: \"1.37\"\n") {
+		t.Fatalf("the kustomization has no override for docker.io/library/busybox:\n%s", written)
+	}
+}
+
+func TestImageWithCurrentTag(t *testing.T) {
+	files := demotest.Files()
+	r := testRegistry{"example.com/http": {"v0.9.0", "v1.0.0"}}
+
+	b, err := Image(context.Background(), demotest.App(), files, "production", "example.com/http", r, registry.Policy{Semver: ">=0.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(b.Images); l != 0 {
+		t.Fatalf("got %d bumped images, want 0", l)
+	}
+	changes, err := files.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(changes); l != 0 {
+		t.Fatalf("got %d changes, want 0", l)
+	}
+}
+
+func TestImageErrors(t *testing.T) {
+	r := testRegistry{"example.com/http": {"v1.0.0"}}
+	tests := []struct {
+		env, name string
+		wantErr   string
+	}{
+		{"unknown", "example.com/http", `unknown environment "unknown" in app demo`},
+		{"production", "example.com/unknown", "image example.com/unknown isn't used in environment production of app demo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := Image(context.Background(), demotest.App(), demotest.Files(), tt.env, tt.name, r, registry.Policy{})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := Image(context.Background(), demotest.App(), demotest.Files(), "production", "example.com/http", r, registry.Policy{Semver: ">=2.0.0"})
+	if !errors.Is(err, registry.ErrNoMatchingTags) {
+		t.Fatalf("got error %v, want %v", err, registry.ErrNoMatchingTags)
+	}
+}
+
+func TestBumpMessage(t *testing.T) {
+	b := &Bump{
+		App:         "demo",
+		Environment: "production",
+		Images:      []*config.ImageChange{demotest.ImageChange("example.com/http", "example.com/http:v1.0.0", "example.com/http:v1.2.0")},
+	}
+
+	want := `Bump example.com/http to v1.2.0 in production
+
+Updates the images in the production environment of demo:
+
+- example.com/http:v1.0.0 -> example.com/http:v1.2.0
+`
+	if diff := cmp.Diff(want, b.Message()); diff != "" {
+		t.Fatalf("incorrect message:\n%s", diff)
+	}
+}
+
+// testRegistry is a registry with the tags for image names, the images were
+// created in the order of their tags.
+type testRegistry map[string][]string
+
+func (r testRegistry) Tags(ctx context.Context, ref image.Reference) ([]string, error) {
+	tags, ok := r[ref.Name()]
+	if !ok {
+		return nil, errors.New("unknown repository")
+	}
+	return tags, nil
+}
+
+func (r testRegistry) Created(ctx context.Context, ref image.Reference) (time.Time, error) {
+	for i, tag := range r[ref.Name()] {
+		if tag == ref.Tag {
+			return time.Date(2020, time.March, i+1, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, errors.New("unknown tag")
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/bump"
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/registry"
+)
+
+func makeBumpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bump",
+		Short: "update the tag of an image in an environment of an app to the newest tag in its registry",
+		Long: fmt.Sprintf(`Reads the tags of an image that's rendered in an environment from the image's
+registry, selects the newest tag, and writes an image override with the tag to
+the kustomization of the environment.
+
+With --semver, the highest version in the range is selected, otherwise the
+tag of the most recently built image is selected, from the build times in the
+images' configurations, --filter limits the tags to those that match a regular
+expression, and without --semver, at most %d tags can match.
+
+Registries are authenticated with the credentials configured for
+"https://<registry>/", with a username and password.
+
+The changes are made in the same way as promote.`, registry.MaxInspectedTags),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, append([]string{"config", "app", "env", "image", "semver", "filter", "plain-http"}, changeFlags...)...)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			name := viper.GetString("image")
+			ref, err := image.Parse(name)
+			if err != nil {
+				return err
+			}
+			r, err := registryClient(cfg, ref.Registry)
+			if err != nil {
+				return err
+			}
+			changes, err := newChangeSet(cmd.Context(), cfg, app)
+			if err != nil {
+				return err
+			}
+			policy := registry.Policy{Semver: viper.GetString("semver"), Filter: viper.GetString("filter")}
+			b, err := bump.Image(cmd.Context(), app, changes.Files, viper.GetString("env"), name, r, policy)
+			if err != nil {
+				return err
+			}
+			if len(b.Images) == 0 {
+				fmt.Printf("%s is up to date in %s\n", name, b.Environment)
+				return nil
+			}
+			for _, c := range b.Images {
+				fmt.Printf("bumping %s to %s\n", c.From.Familiar(), c.To.Familiar())
+			}
+			return changes.publish(cmd.Context(), b.Environment, b.Message(), fmt.Sprintf("peanut/bump-%s", b.Environment))
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"env",
+		"",
+		"environment of the app to bump the image in",
+	)
+	logIfError(cmd.MarkFlagRequired("env"))
+
+	cmd.Flags().String(
+		"image",
+		"",
+		"name of the image to bump, without a tag",
+	)
+	logIfError(cmd.MarkFlagRequired("image"))
+
+	cmd.Flags().String(
+		"semver",
+		"",
+		"semantic version range to select the highest tag in, e.g. \">=1.2.0 <2.0.0\"",
+	)
+
+	cmd.Flags().String(
+		"filter",
+		"",
+		"regular expression that tags must match",
+	)
+
+	cmd.Flags().Bool(
+		"plain-http",
+		false,
+		"connect to the registry over HTTP rather than HTTPS",
+	)
+
+	addChangeFlags(cmd)
+	return cmd
+}
+
+// registryClient returns a client for a registry, with the username and
+// password configured for the registry, if there are any.
+func registryClient(cfg *config.Config, host string) (*registry.Client, error) {
+	c := registry.New(nil)
+	c.PlainHTTP = viper.GetBool("plain-http")
+	auth, err := cfg.AuthFor("https://" + host + "/")
+	if err != nil {
+		return nil, err
+	}
+	switch a := auth.(type) {
+	case nil:
+	case *githttp.BasicAuth:
+		c.Username, c.Password = a.Username, a.Password
+	default:
+		return nil, fmt.Errorf("registry %s can only be authenticated with a username and password", host)
+	}
+	return c, nil
+}
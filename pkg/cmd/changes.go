@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/render"
+	"github.com/bigkevmcd/peanut/pkg/repository"
+	"github.com/bigkevmcd/peanut/pkg/scm"
+)
+
+// changeFlags are the flags for commands that change the files in an app's
+// repository.
+var changeFlags = []string{"dir", "dry-run", "push", "branch", "pull-request"}
+
+func addChangeFlags(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"dir",
+		".",
+		"directory of a checkout of the app's repository",
+	)
+
+	cmd.Flags().Bool(
+		"dry-run",
+		false,
+		"show the changes without writing them",
+	)
+
+	cmd.Flags().Bool(
+		"push",
+		false,
+		"commit the changes and push them to the app's repository, rather than writing them to the checkout",
+	)
+
+	cmd.Flags().String(
+		"branch",
+		"",
+		"branch to push the commit to, defaults to the app's configured revision if it's a branch, or the repository's default branch",
+	)
+
+	cmd.Flags().Bool(
+		"pull-request",
+		false,
+		"push the changes to a new branch, and open a pull request to merge it",
+	)
+}
+
+// changeSet is the files of an app's repository that are being changed,
+// either in a checkout on disk, or at the app's configured revision if the
+// changes are pushed.
+type changeSet struct {
+	cfg    *config.Config
+	app    *config.App
+	repos  *repository.Manager
+	base   filesys.FileSystem
+	parent plumbing.Hash
+	// Files is the copy of the base that the changes are written to.
+	Files *gitfs.Overlay
+
+	provider scm.Provider
+	repo     string
+}
+
+// newChangeSet reads the files to change, based on the change flags.
+func newChangeSet(ctx context.Context, cfg *config.Config, app *config.App) (*changeSet, error) {
+	c := &changeSet{cfg: cfg, app: app}
+	if viper.GetString("branch") != "" && !c.push() {
+		return nil, errors.New("a branch can only be used with --push")
+	}
+	if viper.GetBool("pull-request") {
+		var err error
+		c.provider, c.repo, err = app.SCMProvider()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.push() {
+		var err error
+		c.repos = repository.New(cfg.AuthFor)
+		c.base, c.parent, err = c.repos.FileSystem(ctx, app.RepoURL, app.Revision)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c.base = gitfs.NewDir(viper.GetString("dir"))
+	}
+	c.Files = gitfs.NewOverlay(c.base)
+	return c, nil
+}
+
+func (c *changeSet) push() bool {
+	return viper.GetBool("push") || viper.GetBool("pull-request")
+}
+
+// publish shows the diff of the changed files, and unless it's a dry run,
+// writes them to the checkout, or commits and pushes them, and opens a pull
+// request.
+//
+// The env is the environment that's changed, and the branch is the prefix of
+// the branch for pull requests if no branch is provided, it's followed by a
+// hash of the changes, so that each change is pushed to a new branch.
+func (c *changeSet) publish(ctx context.Context, env, message, branch string) error {
+	changes, err := c.Files.Changes()
+	if err != nil {
+		return err
+	}
+	var diff strings.Builder
+	if err := writeChangesDiff(&diff, c.base, changes); err != nil {
+		return err
+	}
+	fmt.Print(diff.String())
+	if viper.GetBool("dry-run") {
+		return nil
+	}
+	if !c.push() {
+		return writeChanges(viper.GetString("dir"), changes)
+	}
+
+	author, committer, err := c.cfg.Signatures(time.Now())
+	if err != nil {
+		return err
+	}
+	if b := viper.GetString("branch"); b != "" || c.provider == nil {
+		branch = b
+	} else {
+		branch = branch + "-" + changesHash(c.parent, changes)
+	}
+	h, branch, err := repository.NewCommitter(c.cfg.AuthFor).Commit(ctx, c.app.RepoURL, &repository.Commit{
+		Parent:    c.parent,
+		Revision:  c.app.Revision,
+		Changes:   changes,
+		Message:   message,
+		Author:    author,
+		Committer: committer,
+		Branch:    branch,
+	})
+	if errors.Is(err, repository.ErrNotBranch) {
+		return fmt.Errorf("%w, use --branch to name the branch to push to", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("pushed %s to %s\n", h, branch)
+	if c.provider == nil {
+		return nil
+	}
+
+	base, err := c.repos.Branch(ctx, c.app.RepoURL, c.app.Revision)
+	if err != nil && !errors.Is(err, repository.ErrNotBranch) {
+		return err
+	}
+	resources, err := render.DiffFileSystems(c.app.Environment(env).Path(), c.base, c.Files)
+	if err != nil {
+		return err
+	}
+	pr, err := openPullRequest(ctx, c.provider, c.repo, &pullRequest{
+		branch:    branch,
+		base:      base,
+		message:   message,
+		diff:      diff.String(),
+		resources: resources,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("opened pull request %d: %s\n", pr.Number, pr.URL)
+	return nil
+}
+
+// changesHash returns a short hash of the changes and the commit that they
+// were made to.
+func changesHash(parent plumbing.Hash, changes []gitfs.Change) string {
+	h := sha256.New()
+	h.Write(parent[:])
+	for _, c := range changes {
+		fmt.Fprintf(h, "%s\x00%t\x00%d\x00", c.Path, c.Removed, len(c.Contents))
+		h.Write(c.Contents)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// writeChangesDiff writes a unified diff of each of the changed files.
+func writeChangesDiff(w io.Writer, base filesys.FileSystem, changes []gitfs.Change) error {
+	for _, c := range changes {
+		before := ""
+		if base.Exists(c.Path) {
+			b, err := base.ReadFile(c.Path)
+			if err != nil {
+				return err
+			}
+			before = string(b)
+		}
+		fmt.Fprint(w, render.UnifiedDiff("a/"+c.Path, "b/"+c.Path, before, string(c.Contents)))
+	}
+	return nil
+}
+
+// writeChanges writes the changed files to a directory on disk.
+func writeChanges(dir string, changes []gitfs.Change) error {
+	for _, c := range changes {
+		name := filepath.Join(dir, filepath.FromSlash(c.Path))
+		if c.Removed {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, c.Contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+const containersHeader = "container\trole\timage\tports\trequests\tlimits\t"
+
+// writeContainers writes a row for each of the service's containers, each row
+// starts with the prefix columns.
+//
+// Images that can't be parsed are written as they are in the manifest.
+func writeContainers(w io.Writer, prefix string, svc *parser.Service) {
+	for _, c := range svc.Containers {
+		var requests, limits map[string]string
+		if c.Resources != nil {
+			requests, limits = c.Resources.Requests, c.Resources.Limits
+		}
+		img := c.ImageName
+		if !c.Image.IsZero() {
+			img = c.Image.Familiar()
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t\n", prefix, c.Name, c.Role, img, formatPorts(c.Ports), formatQuantities(requests), formatQuantities(limits))
+	}
+}
+
+// formatPorts formats ports as e.g. "http:8080/TCP,9090".
+func formatPorts(ports []parser.Port) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = fmt.Sprint(p.ContainerPort)
+		if p.Name != "" {
+			s[i] = p.Name + ":" + s[i]
+		}
+		if p.Protocol != "" {
+			s[i] += "/" + p.Protocol
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// formatQuantities formats resource quantities in name order, e.g.
+// "cpu=100m,memory=128Mi".
+func formatQuantities(q map[string]string) string {
+	s := make([]string, 0, len(q))
+	for k, v := range q {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
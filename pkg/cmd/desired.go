@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+	"github.com/bigkevmcd/peanut/pkg/repository"
+)
+
+func makeDesiredCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "desired",
+		Short: "show the desired state of an app from its Git repository",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, append([]string{"config", "app", "revision", "workers", "containers"}, labelFlags...)...)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			labels := parser.Labels{}
+			if app.Labels != nil {
+				labels = *app.Labels
+			}
+			labels = labelsFromFlags(labels)
+			if err := labels.Validate(); err != nil {
+				return err
+			}
+			app.Labels = &labels
+			state, err := parseApp(cmd.Context(), cfg, app)
+			if err != nil {
+				return err
+			}
+
+			// Every app has the same warnings for an environment.
+			for _, env := range state.App(app.Name).Environments {
+				for _, v := range env.Warnings {
+					fmt.Fprintf(os.Stderr, "warning: %s: %s\n", env.Name, v)
+				}
+				reportSkipped(env.Name+": ", env.Skipped)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.TabIndent)
+			defer w.Flush()
+			for _, a := range state.Apps {
+				fmt.Fprintf(w, "application: %s\n", a.Name)
+				if viper.GetBool("containers") {
+					fmt.Fprintln(w, "environment\tname\t"+containersHeader)
+					for _, env := range a.Environments {
+						for _, svc := range env.Services {
+							writeContainers(w, env.Name+"\t"+svc.Name+"\t", svc)
+						}
+					}
+					continue
+				}
+				fmt.Fprintln(w, "environment\tname\tkind\tnamespace\treplicas\timages\tworkloads\t")
+				for _, env := range a.Environments {
+					for _, svc := range env.Services {
+						images := formatImages(svc.Images)
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t\n", env.Name, svc.Name, svc.Kind, svc.Namespace, svc.Replicas, images, formatComponents(svc.Components))
+					}
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"revision",
+		"",
+		"branch, tag or commit to read the app from, defaults to the app's configured revision",
+	)
+
+	cmd.Flags().Int(
+		"workers",
+		config.DefaultWorkers,
+		"number of Kustomize builds to run at the same time",
+	)
+
+	cmd.Flags().Bool(
+		"containers",
+		false,
+		"list the containers of each service",
+	)
+	addLabelFlags(cmd)
+	return cmd
+}
+
+// loadApp reads the configuration file, and finds the app, from the "config"
+// and "app" flags.
+func loadApp() (*config.Config, *config.App, error) {
+	cfg, err := config.ParseFile(viper.GetString("config"))
+	if err != nil {
+		return nil, nil, err
+	}
+	app := cfg.App(viper.GetString("app"))
+	if app == nil {
+		return nil, nil, fmt.Errorf("unknown app %q", viper.GetString("app"))
+	}
+	return cfg, app, nil
+}
+
+// parseApp parses the desired state of the app from its repository, at the
+// revision from the "revision" flag, or the app's configured revision.
+func parseApp(ctx context.Context, cfg *config.Config, app *config.App) (*config.DesiredState, error) {
+	rev := viper.GetString("revision")
+	if rev == "" {
+		rev = app.Revision
+	}
+	repos := repository.New(cfg.AuthFor)
+	gfs, commit, err := repos.FileSystem(ctx, app.RepoURL, rev)
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseManifestsConcurrently(app, gfs, commit, viper.GetInt("workers"))
+}
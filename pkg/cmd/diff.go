@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+)
+
+func makeDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "show the differences between the services in two environments of an app",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, "config", "app", "from", "to", "revision", "workers")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			from, to := viper.GetString("from"), viper.GetString("to")
+			for _, name := range []string{from, to} {
+				if app.Environment(name) == nil {
+					return fmt.Errorf("unknown environment %q in app %s", name, app.Name)
+				}
+			}
+			state, err := parseApp(cmd.Context(), cfg, app)
+			if err != nil {
+				return err
+			}
+			diff, err := config.DiffEnvironments(state.App(app.Name), from, to)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.TabIndent)
+			defer w.Flush()
+			writeDiff(w, diff)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"from",
+		"",
+		"environment to compare from",
+	)
+	logIfError(cmd.MarkFlagRequired("from"))
+
+	cmd.Flags().String(
+		"to",
+		"",
+		"environment to compare to",
+	)
+	logIfError(cmd.MarkFlagRequired("to"))
+
+	cmd.Flags().String(
+		"revision",
+		"",
+		"branch, tag or commit to read the app from, defaults to the app's configured revision",
+	)
+
+	cmd.Flags().Int(
+		"workers",
+		config.DefaultWorkers,
+		"number of Kustomize builds to run at the same time",
+	)
+	return cmd
+}
+
+// writeDiff writes a row for each of the differences between the services.
+func writeDiff(w io.Writer, diff *config.Diff) {
+	fmt.Fprintf(w, "application: %s\n", diff.App)
+	fmt.Fprintf(w, "service\tchange\tfield\t%s\t%s\t\n", diff.From, diff.To)
+	for _, d := range diff.Services {
+		switch d.Change {
+		case config.ServiceAdded:
+			fmt.Fprintf(w, "%s\t%s\t\t\t%s\t\n", d.Name, d.Change, formatImages(d.Service.Images))
+		case config.ServiceRemoved:
+			fmt.Fprintf(w, "%s\t%s\t\t%s\t\t\n", d.Name, d.Change, formatImages(d.Service.Images))
+		}
+		if d.Namespace != nil {
+			fmt.Fprintf(w, "%s\t%s\tnamespace\t%s\t%s\t\n", d.Name, d.Change, d.Namespace.From, d.Namespace.To)
+		}
+		if d.Replicas != nil {
+			fmt.Fprintf(w, "%s\t%s\treplicas\t%d\t%d\t\n", d.Name, d.Change, d.Replicas.From, d.Replicas.To)
+		}
+		for _, c := range d.Images {
+			from, to := "", ""
+			if c.From != nil {
+				from = c.From.Familiar()
+			}
+			if c.To != nil {
+				to = c.To.Familiar()
+			}
+			fmt.Fprintf(w, "%s\t%s\timage\t%s\t%s\t\n", d.Name, d.Change, from, to)
+		}
+	}
+}
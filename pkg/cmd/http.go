@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/bigkevmcd/peanut/pkg/config"
 	httpapi "github.com/bigkevmcd/peanut/pkg/http"
+	"github.com/bigkevmcd/peanut/pkg/repository"
 )
 
 func makeHTTPCmd() *cobra.Command {
@@ -17,11 +19,21 @@ func makeHTTPCmd() *cobra.Command {
 		Use:   "http",
 		Short: "provide a simple app API",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			interval := viper.GetDuration("fetch-interval")
+			if interval < 0 {
+				return fmt.Errorf("invalid fetch interval %s, it must not be negative", interval)
+			}
 			cfg, err := config.ParseFile(viper.GetString("config"))
 			if err != nil {
 				return err
 			}
-			http.Handle("/", httpapi.NewRouter(cfg))
+			repos := repository.New(cfg.AuthFor)
+			if interval > 0 {
+				go repos.Poll(cmd.Context(), interval)
+			}
+			router := httpapi.NewRouter(cfg, repos)
+			router.Workers = viper.GetInt("workers")
+			http.Handle("/", router)
 			listen := fmt.Sprintf(":%d", viper.GetInt("port"))
 			log.Printf("listening %s\n", listen)
 			return http.ListenAndServe(listen, nil)
@@ -42,5 +54,19 @@ func makeHTTPCmd() *cobra.Command {
 	)
 	logIfError(viper.BindPFlag("config", cmd.Flags().Lookup("config")))
 	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().Duration(
+		"fetch-interval",
+		time.Minute,
+		"how often to fetch changes to the app repositories, 0 disables fetching",
+	)
+	logIfError(viper.BindPFlag("fetch-interval", cmd.Flags().Lookup("fetch-interval")))
+
+	cmd.Flags().Int(
+		"workers",
+		config.DefaultWorkers,
+		"number of Kustomize builds to run at the same time",
+	)
+	logIfError(viper.BindPFlag("workers", cmd.Flags().Lookup("workers")))
 	return cmd
 }
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/kustomize"
+)
+
+func makeImagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "edit the image overrides of a kustomization",
+	}
+	cmd.AddCommand(makeImagesSetCmd())
+	cmd.AddCommand(makeImagesUnsetCmd())
+	return cmd
+}
+
+func makeImagesSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "set the new name, tag or digest of an image",
+		Long: `Adds or updates the override for an image in the kustomization in a
+directory.
+
+The fields of an existing override that aren't set are kept, except that
+setting a tag removes a digest, a tag and a digest can be set together, to
+write the image as "name:tag@digest".`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, "dir", "dry-run", "image", "new-name", "tag", "digest")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, tag, digest := viper.GetString("new-name"), viper.GetString("tag"), viper.GetString("digest")
+			if name == "" && tag == "" && digest == "" {
+				return errors.New("one of --new-name, --tag or --digest is required")
+			}
+			return editImages(func(k *kustomize.Kustomizer) error {
+				img := viper.GetString("image")
+				if name != "" {
+					if err := k.SetImageName(img, name); err != nil {
+						return err
+					}
+				}
+				if tag != "" {
+					if err := k.AddImageOverride(img, tag); err != nil {
+						return err
+					}
+				}
+				if digest != "" {
+					return k.SetImageDigest(img, digest)
+				}
+				return nil
+			})
+		},
+	}
+	addImagesFlags(cmd)
+
+	cmd.Flags().String(
+		"new-name",
+		"",
+		"name to replace the image's name with, e.g. when it's moved to another registry",
+	)
+
+	cmd.Flags().String(
+		"tag",
+		"",
+		"tag to replace the image's tag with",
+	)
+
+	cmd.Flags().String(
+		"digest",
+		"",
+		"digest to pin the image to, e.g. sha256:...",
+	)
+	return cmd
+}
+
+func makeImagesUnsetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unset",
+		Short: "remove the override for an image",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, "dir", "dry-run", "image")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editImages(func(k *kustomize.Kustomizer) error {
+				img := viper.GetString("image")
+				if _, ok := k.ImageOverride(img); !ok {
+					return fmt.Errorf("image %s has no override", img)
+				}
+				k.RemoveImageOverride(img)
+				return nil
+			})
+		},
+	}
+	addImagesFlags(cmd)
+	return cmd
+}
+
+func addImagesFlags(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"dir",
+		".",
+		"directory of the kustomization to edit",
+	)
+
+	cmd.Flags().Bool(
+		"dry-run",
+		false,
+		"show the changes without writing them",
+	)
+
+	cmd.Flags().String(
+		"image",
+		"",
+		"name of the image in the override, without a tag",
+	)
+	logIfError(cmd.MarkFlagRequired("image"))
+}
+
+// editImages edits the image overrides of the kustomization in the dir flag,
+// and shows the diff before writing it, unless it's a dry run.
+func editImages(edit func(*kustomize.Kustomizer) error) error {
+	dir := viper.GetString("dir")
+	base := gitfs.NewDir(dir)
+	files := gitfs.NewOverlay(base)
+	filename, k, err := kustomize.ReadKustomization(files, ".")
+	if err != nil {
+		return err
+	}
+	if err := edit(k); err != nil {
+		return err
+	}
+	if err := kustomize.WriteKustomization(files, filename, k); err != nil {
+		return err
+	}
+	changes, err := files.Changes()
+	if err != nil {
+		return err
+	}
+	if err := writeChangesDiff(os.Stdout, base, changes); err != nil {
+		return err
+	}
+	if viper.GetBool("dry-run") {
+		return nil
+	}
+	return writeChanges(dir, changes)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+var labelFlags = []string{"app-label", "service-label", "app-fallback"}
+
+func addLabelFlags(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"app-label",
+		"",
+		"label or annotation that names the app of a workload, defaults to app.kubernetes.io/part-of",
+	)
+	cmd.Flags().String(
+		"service-label",
+		"",
+		"label or annotation that names the service of a workload, defaults to app.kubernetes.io/name, workloads without it are named after themselves",
+	)
+	cmd.Flags().String(
+		"app-fallback",
+		"",
+		"how to name the app of workloads without the app label, \"directory\" uses the kustomization's directory name",
+	)
+}
+
+// labelsFromFlags overrides the labels with the flags that are set.
+func labelsFromFlags(l parser.Labels) parser.Labels {
+	if v := viper.GetString("app-label"); v != "" {
+		l.App = v
+	}
+	if v := viper.GetString("service-label"); v != "" {
+		l.Service = v
+	}
+	if v := viper.GetString("app-fallback"); v != "" {
+		l.Fallback = v
+	}
+	return l
+}
+
+// reportSkipped writes the workloads that weren't part of an app to stderr,
+// the prefix identifies where they were skipped from.
+func reportSkipped(prefix string, skipped []parser.Workload) {
+	for _, w := range skipped {
+		name := w.Name
+		if w.Namespace != "" {
+			name = w.Namespace + "/" + name
+		}
+		fmt.Fprintf(os.Stderr, "skipped: %s%s %s is not labelled as part of an app\n", prefix, w.Kind, name)
+	}
+}
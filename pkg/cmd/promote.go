@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/promote"
+)
+
+func makePromoteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "copy the images of a service from one environment of an app to another",
+		Long: `Reads the images of a service that are rendered in the "from" environment,
+and writes image overrides to the kustomization of the "to" environment.
+
+The changes are made to a checkout of the app's repository, or with --push,
+are committed to the app's configured revision, and pushed to the same
+branch, or the default branch if there's no revision, or to a new branch with
+--branch, the diff is shown before the changes are written.
+
+With --pull-request, the changes are pushed to a new branch, and a pull
+request is opened with the app's SCM provider.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, append([]string{"config", "app", "service", "from", "to"}, changeFlags...)...)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			changes, err := newChangeSet(cmd.Context(), cfg, app)
+			if err != nil {
+				return err
+			}
+			p, err := promote.Promote(app, changes.Files, viper.GetString("service"), viper.GetString("from"), viper.GetString("to"))
+			if err != nil {
+				return err
+			}
+			if len(p.Images) == 0 {
+				fmt.Printf("%s has the same images in %s and %s\n", p.Service, p.From, p.To)
+				return nil
+			}
+			for _, c := range p.Images {
+				fmt.Printf("promoting %s to %s\n", c.From.Familiar(), c.To.Familiar())
+			}
+			return changes.publish(cmd.Context(), p.To, p.Message(), fmt.Sprintf("peanut/promote-%s-%s", p.Service, p.To))
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"service",
+		"",
+		"name of the service to promote",
+	)
+	logIfError(cmd.MarkFlagRequired("service"))
+
+	cmd.Flags().String(
+		"from",
+		"",
+		"environment to promote the images from",
+	)
+	logIfError(cmd.MarkFlagRequired("from"))
+
+	cmd.Flags().String(
+		"to",
+		"",
+		"environment to promote the images to",
+	)
+	logIfError(cmd.MarkFlagRequired("to"))
+
+	addChangeFlags(cmd)
+	return cmd
+}
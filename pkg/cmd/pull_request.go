@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bigkevmcd/peanut/pkg/render"
+	"github.com/bigkevmcd/peanut/pkg/scm"
+)
+
+// pullRequest is a pull request to open for a pushed branch.
+type pullRequest struct {
+	branch string
+	// base is the branch to merge into, the repository's default branch is
+	// used if it's empty.
+	base    string
+	message string
+	// diff is a unified diff of the changed files.
+	diff string
+	// resources are the differences in the rendered manifests, which are
+	// added as a comment.
+	resources []*render.ResourceDiff
+}
+
+// openPullRequest opens a pull request for a repository, to merge the branch
+// into the base branch, or the repository's default branch.
+//
+// The title is the first line of the commit message, and the body is the rest
+// of the message, followed by the diff of the changed files.
+func openPullRequest(ctx context.Context, provider scm.Provider, repo string, pr *pullRequest) (*scm.PullRequest, error) {
+	base := pr.base
+	if base == "" {
+		var err error
+		base, err = provider.DefaultBranch(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	title, body, _ := strings.Cut(pr.message, "\n")
+	body = strings.TrimSpace(body) + "\n\n```diff\n" + pr.diff + "```\n"
+	opened, err := provider.OpenPullRequest(ctx, repo, scm.PullRequestOptions{
+		Title: title,
+		Body:  body,
+		Head:  pr.branch,
+		Base:  base,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pr.resources) == 0 {
+		return opened, nil
+	}
+	if err := provider.Comment(ctx, repo, opened.Number, resourcesComment(pr.resources)); err != nil {
+		return nil, fmt.Errorf("failed to comment on pull request %d: %w", opened.Number, err)
+	}
+	return opened, nil
+}
+
+// resourcesComment formats the differences in the rendered resources as
+// Markdown.
+func resourcesComment(diffs []*render.ResourceDiff) string {
+	var b strings.Builder
+	b.WriteString("Changes to the rendered manifests:\n")
+	for _, d := range diffs {
+		fmt.Fprintf(&b, "\n**%s** `%s`\n", d.Change, d.ID())
+		if d.Diff != "" {
+			fmt.Fprintf(&b, "\n```diff\n%s```\n", d.Diff)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/render"
+	"github.com/bigkevmcd/peanut/pkg/repository"
+)
+
+func makeRenderCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "write the rendered manifests of an environment",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, "config", "app", "env", "revision", "kind", "name", "selector", "output")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			write := render.WriteYAML
+			switch viper.GetString("output") {
+			case "yaml":
+			case "json":
+				write = render.WriteJSON
+			default:
+				return fmt.Errorf("unknown output format %q", viper.GetString("output"))
+			}
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			env := app.Environment(viper.GetString("env"))
+			if env == nil {
+				return fmt.Errorf("unknown environment %q in app %s", viper.GetString("env"), app.Name)
+			}
+			rev := viper.GetString("revision")
+			if rev == "" {
+				rev = app.Revision
+			}
+			gfs, _, err := repository.New(cfg.AuthFor).FileSystem(cmd.Context(), app.RepoURL, rev)
+			if err != nil {
+				return err
+			}
+			resources, err := render.Manifests(env.Path(), gfs, render.Filter{
+				Kind:     viper.GetString("kind"),
+				Name:     viper.GetString("name"),
+				Selector: viper.GetString("selector"),
+			})
+			if err != nil {
+				return err
+			}
+			return write(os.Stdout, resources)
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"env",
+		"",
+		"environment of the app to render",
+	)
+	logIfError(cmd.MarkFlagRequired("env"))
+
+	cmd.Flags().String(
+		"revision",
+		"",
+		"branch, tag or commit to render, defaults to the app's configured revision",
+	)
+
+	cmd.Flags().String(
+		"kind",
+		"",
+		"only write resources of this kind",
+	)
+
+	cmd.Flags().String(
+		"name",
+		"",
+		"only write resources with this name",
+	)
+
+	cmd.Flags().String(
+		"selector",
+		"",
+		"only write resources that match this label selector e.g. app.kubernetes.io/name=redis",
+	)
+
+	cmd.Flags().String(
+		"output",
+		"yaml",
+		"format to write the resources in, yaml or json",
+	)
+	return cmd
+}
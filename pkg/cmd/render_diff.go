@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/bigkevmcd/peanut/pkg/render"
+	"github.com/bigkevmcd/peanut/pkg/repository"
+)
+
+func makeRenderDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render-diff",
+		Short: "show the differences between the rendered manifests of an environment at two revisions",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindFlags(cmd, "config", "app", "env", "base", "head")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, app, err := loadApp()
+			if err != nil {
+				return err
+			}
+			env := app.Environment(viper.GetString("env"))
+			if env == nil {
+				return fmt.Errorf("unknown environment %q in app %s", viper.GetString("env"), app.Name)
+			}
+			base, head := viper.GetString("base"), viper.GetString("head")
+			if base == "" {
+				base = app.Revision
+			}
+			if head == "" {
+				head = app.Revision
+			}
+			repos := repository.New(cfg.AuthFor)
+			baseFS, _, err := repos.FileSystem(cmd.Context(), app.RepoURL, base)
+			if err != nil {
+				return err
+			}
+			headFS, _, err := repos.FileSystem(cmd.Context(), app.RepoURL, head)
+			if err != nil {
+				return err
+			}
+			diffs, err := render.DiffFileSystems(env.Path(), baseFS, headFS)
+			if err != nil {
+				return err
+			}
+			writeResourceDiffs(os.Stdout, diffs)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(
+		"config",
+		"",
+		"file to parse configuration from",
+	)
+	logIfError(cmd.MarkFlagRequired("config"))
+
+	cmd.Flags().String(
+		"app",
+		"",
+		"name of the app in the configuration",
+	)
+	logIfError(cmd.MarkFlagRequired("app"))
+
+	cmd.Flags().String(
+		"env",
+		"",
+		"environment of the app to render",
+	)
+	logIfError(cmd.MarkFlagRequired("env"))
+
+	cmd.Flags().String(
+		"base",
+		"",
+		"branch, tag or commit to compare from, defaults to the app's configured revision",
+	)
+
+	cmd.Flags().String(
+		"head",
+		"",
+		"branch, tag or commit to compare to, defaults to the app's configured revision",
+	)
+	return cmd
+}
+
+// writeResourceDiffs writes each changed resource, followed by the unified
+// diff of a changed resource, or the manifest of an added or removed one.
+func writeResourceDiffs(w io.Writer, diffs []*render.ResourceDiff) {
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s %s\n", d.Change, d.ID())
+		switch d.Change {
+		case render.ResourceAdded:
+			fmt.Fprint(w, d.Head)
+		case render.ResourceRemoved:
+			fmt.Fprint(w, d.Base)
+		default:
+			fmt.Fprint(w, d.Diff)
+		}
+	}
+}
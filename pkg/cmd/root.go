@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 
+	"github.com/bigkevmcd/peanut/pkg/image"
 	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
 )
 
@@ -28,19 +31,34 @@ func makeRootCmd() *cobra.Command {
 		Use:   "peanut",
 		Short: "Just a Go Kubernetes resource analyzer",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := parser.Parse(viper.GetString("kustomization-path"))
+			labels := labelsFromFlags(parser.Labels{})
+			if err := labels.Validate(); err != nil {
+				return err
+			}
+			cfg, err := parseKustomization(viper.GetString("kustomization-path"), viper.GetString("revision"), labels)
 			if err != nil {
 				return err
 			}
+			for _, w := range cfg.Warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+			}
+			reportSkipped("", cfg.Skipped)
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.TabIndent)
 			defer w.Flush()
 
 			for _, app := range cfg.Apps {
 				fmt.Fprintf(w, "application: %s\n", app.Name)
-				fmt.Fprintln(w, "name\tnamespace\treplicas\timages\t")
+				if viper.GetBool("containers") {
+					fmt.Fprintln(w, "name\t"+containersHeader)
+					for _, svc := range app.Services {
+						writeContainers(w, svc.Name+"\t", svc)
+					}
+					continue
+				}
+				fmt.Fprintln(w, "name\tkind\tnamespace\treplicas\timages\tworkloads\t")
 				for _, svc := range app.Services {
-					images := strings.Join(svc.Images, ",")
-					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t\n", svc.Name, svc.Namespace, svc.Replicas, images)
+					images := formatImages(svc.Images)
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t\n", svc.Name, svc.Kind, svc.Namespace, svc.Replicas, images, formatComponents(svc.Components))
 				}
 			}
 
@@ -56,10 +74,84 @@ func makeRootCmd() *cobra.Command {
 	logIfError(viper.BindPFlag("kustomization-path", cmd.Flags().Lookup("kustomization-path")))
 	logIfError(cmd.MarkFlagRequired("kustomization-path"))
 
+	cmd.Flags().String(
+		"revision",
+		"",
+		"branch, tag or commit of the enclosing Git repository to read the kustomization from",
+	)
+	logIfError(viper.BindPFlag("revision", cmd.Flags().Lookup("revision")))
+
+	cmd.Flags().Bool(
+		"containers",
+		false,
+		"list the containers of each service",
+	)
+	logIfError(viper.BindPFlag("containers", cmd.Flags().Lookup("containers")))
+
+	addLabelFlags(cmd)
+	logIfError(bindFlags(cmd, labelFlags...))
+
 	cmd.AddCommand(makeHTTPCmd())
+	cmd.AddCommand(makeDesiredCmd())
+	cmd.AddCommand(makeDiffCmd())
+	cmd.AddCommand(makeRenderCmd())
+	cmd.AddCommand(makeRenderDiffCmd())
+	cmd.AddCommand(makePromoteCmd())
+	cmd.AddCommand(makeBumpCmd())
+	cmd.AddCommand(makeImagesCmd())
 	return cmd
 }
 
+// parseKustomization parses the kustomization from the disk, or from a
+// revision of the Git repository that the path is in.
+func parseKustomization(path, rev string, l parser.Labels) (*parser.Config, error) {
+	if rev == "" {
+		// The absolute path names the directory for the directory fallback.
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		return parser.ParseConfigWithLabels(abs, filesys.MakeFsOnDisk(), l)
+	}
+	rel, gfs, err := parser.FileSystemAtRevision(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseConfigWithLabels(rel, gfs, l)
+}
+
+// formatImages formats images in their shortest form, e.g.
+// "redis:6-alpine,quay.io/org/app:v1".
+func formatImages(refs []image.Reference) string {
+	s := make([]string, len(refs))
+	for i, v := range refs {
+		s[i] = v.Familiar()
+	}
+	return strings.Join(s, ",")
+}
+
+// formatComponents formats the workloads of a service with their replicas,
+// e.g. "orders-api=3,orders-worker=2".
+func formatComponents(components []*parser.Component) string {
+	s := make([]string, len(components))
+	for i, c := range components {
+		s[i] = fmt.Sprintf("%s=%d", c.Name, c.Replicas)
+	}
+	return strings.Join(s, ",")
+}
+
+// bindFlags binds the named flags of the command that is being executed, so
+// that subcommands can share flag names without overriding each other's
+// bindings.
+func bindFlags(cmd *cobra.Command, names ...string) error {
+	for _, name := range names {
+		if err := viper.BindPFlag(name, cmd.Flags().Lookup(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func initConfig() {
 	viper.AutomaticEnv()
 }
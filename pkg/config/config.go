@@ -1,9 +1,18 @@
 package config
 
 import (
+	"errors"
 	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
 )
 
+// ErrNoAuthor is returned when committing without a configured author.
+var ErrNoAuthor = errors.New("no commit author is configured")
+
 // Environment is a k8s namespace/cluster that an application is deployed.
 type Environment struct {
 	Name    string `json:"name"`
@@ -13,16 +22,58 @@ type Environment struct {
 
 // App represents a high-level application that is deployed across multiple
 // environments, and configured through Kustomize.
+//
+// The RepoURL can be a "file://" URL for a checked-out directory or a bare
+// repository on disk, which is read in place rather than cloned.
+//
+// The Labels identify the apps and services in the manifests, by default
+// workloads are identified by their "app.kubernetes.io/part-of" label.
+//
+// The SCM is used to open pull requests for changes to the repository.
 type App struct {
 	Name         string         `json:"name"`
 	RepoURL      string         `json:"repo_url"`
+	Revision     string         `json:"revision,omitempty"` // Branch, tag or commit, defaults to HEAD.
 	Path         string         `json:"path"`
+	Labels       *parser.Labels `json:"labels,omitempty"`
+	SCM          *SCM           `json:"scm,omitempty"`
 	Environments []*Environment `json:"environments"`
 }
 
-// Config represents the managed apps.
+// Config represents the managed apps, and the credentials for accessing
+// their repositories.
+//
+// The Author and Committer are recorded in the commits that peanut pushes,
+// the Committer defaults to the Author.
 type Config struct {
-	Apps []*App `json:"apps,omitempty"`
+	Apps        []*App        `json:"apps,omitempty"`
+	Credentials []*Credential `json:"credentials,omitempty"`
+	Author      *Identity     `json:"author,omitempty"`
+	Committer   *Identity     `json:"committer,omitempty"`
+}
+
+// Identity is the name and email of a commit author or committer.
+type Identity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Signatures returns the author and committer for a commit made at a time.
+//
+// If no Author is configured, the error is ErrNoAuthor.
+func (c *Config) Signatures(when time.Time) (object.Signature, object.Signature, error) {
+	if c.Author == nil {
+		return object.Signature{}, object.Signature{}, ErrNoAuthor
+	}
+	committer := c.Committer
+	if committer == nil {
+		committer = c.Author
+	}
+	return c.Author.signature(when), committer.signature(when), nil
+}
+
+func (i *Identity) signature(when time.Time) object.Signature {
+	return object.Signature{Name: i.Name, Email: i.Email, When: when}
 }
 
 // App returns the named app, or nil if not found.
@@ -35,24 +86,40 @@ func (c *Config) App(name string) *App {
 	return nil
 }
 
-// Environment gets a named environment.
+// Environment gets a named environment, linked to the app.
+//
+// Parse and LinkEnvironments link the environments up front, so that looking
+// them up only reads them, and is safe to call concurrently, environments of
+// apps that are created in code are linked when they're first looked up.
 func (a *App) Environment(name string) *Environment {
 	for _, v := range a.Environments {
 		if v.Name == name {
-			v.App = a
+			if v.App != a {
+				v.App = a
+			}
 			return v
 		}
 	}
 	return nil
 }
 
+// LinkEnvironments links each of the app's environments to the app, which is
+// needed for their paths.
+//
+// Parse links the apps that it parses, apps that are created in code need to
+// be linked before they're shared.
+func (a *App) LinkEnvironments() {
+	for _, v := range a.Environments {
+		v.App = a
+	}
+}
+
 // EachEnvironment iterates over each environment within the app, and calls it
 // with an environment, the environment will have it's parent app linked
 // correctly.
 func (a *App) EachEnvironment(f func(e *Environment) error) error {
 	for _, v := range a.Environments {
-		err := f(a.Environment(v.Name))
-		if err != nil {
+		if err := f(a.Environment(v.Name)); err != nil {
 			return err
 		}
 	}
@@ -65,5 +132,25 @@ func (a *App) EachEnvironment(f func(e *Environment) error) error {
 // For example, app in /test/base and environment in "../dev" would get
 // "/test/dev".
 func (e *Environment) Path() string {
-	return path.Clean(path.Join(e.App.Path, e.RelPath))
+	return e.App.environmentPath(e)
+}
+
+// labels returns the app's configured Labels, or the defaults if none are
+// configured.
+//
+// Workloads without the app label are part of this app with the directory
+// fallback, rather than an app named after the environment's directory.
+func (a *App) labels() parser.Labels {
+	if a.Labels == nil {
+		return parser.Labels{}
+	}
+	l := *a.Labels
+	l.FallbackApp = a.Name
+	return l
+}
+
+// environmentPath returns the path for an environment's kustomize.yaml,
+// without needing the environment to be linked to the app.
+func (a *App) environmentPath(e *Environment) string {
+	return path.Clean(path.Join(a.Path, e.RelPath))
 }
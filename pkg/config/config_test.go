@@ -2,6 +2,9 @@ package config
 
 import (
 	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -59,6 +62,35 @@ func TestEnvironment(t *testing.T) {
 	}
 }
 
+func TestEnvironmentPathWithoutLinking(t *testing.T) {
+	goDemo := &App{
+		Name:         "go-demo",
+		Path:         "/deploy/environments/base",
+		Environments: []*Environment{{Name: "dev", RelPath: "../dev"}},
+	}
+
+	if v := goDemo.Environment("dev").Path(); v != "/deploy/environments/dev" {
+		t.Fatalf("Path() got %#v, want %#v", v, "/deploy/environments/dev")
+	}
+}
+
+func TestLinkEnvironments(t *testing.T) {
+	goDemo := &App{
+		Name: "go-demo",
+		Environments: []*Environment{
+			{Name: "dev"},
+			{Name: "staging"},
+		},
+	}
+	goDemo.LinkEnvironments()
+
+	for _, v := range goDemo.Environments {
+		if v.App != goDemo {
+			t.Fatalf("environment %s got %#v, want %#v", v.Name, v.App, goDemo)
+		}
+	}
+}
+
 func TestEnvironmentPath(t *testing.T) {
 	dev := &Environment{Name: "dev", RelPath: "../dev"}
 	goDemo := &App{
@@ -74,3 +106,47 @@ func TestEnvironmentPath(t *testing.T) {
 		t.Fatalf("Path() got %#v, want %#v", v, "deploy/environments/dev")
 	}
 }
+
+func TestSignatures(t *testing.T) {
+	when := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	author := &Identity{Name: "Author", Email: "author@example.com"}
+	committer := &Identity{Name: "Committer", Email: "committer@example.com"}
+
+	tests := []struct {
+		cfg           *Config
+		wantAuthor    object.Signature
+		wantCommitter object.Signature
+	}{
+		{
+			&Config{Author: author},
+			object.Signature{Name: "Author", Email: "author@example.com", When: when},
+			object.Signature{Name: "Author", Email: "author@example.com", When: when},
+		},
+		{
+			&Config{Author: author, Committer: committer},
+			object.Signature{Name: "Author", Email: "author@example.com", When: when},
+			object.Signature{Name: "Committer", Email: "committer@example.com", When: when},
+		},
+	}
+
+	for _, tt := range tests {
+		a, c, err := tt.cfg.Signatures(when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.wantAuthor, a); diff != "" {
+			t.Errorf("author didn't match:\n%s", diff)
+		}
+		if diff := cmp.Diff(tt.wantCommitter, c); diff != "" {
+			t.Errorf("committer didn't match:\n%s", diff)
+		}
+	}
+}
+
+func TestSignaturesWithNoAuthor(t *testing.T) {
+	_, _, err := (&Config{}).Signatures(time.Now())
+
+	if err != ErrNoAuthor {
+		t.Fatalf("got error %v, want %v", err, ErrNoAuthor)
+	}
+}
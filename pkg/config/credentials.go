@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const defaultGitUsername = "git"
+
+// Credential is the authentication for repositories under URL, the scheme and
+// host of a repository's URL must be the same, and its path must be within the
+// path of the URL, e.g. https://github.com/org/ matches
+// https://github.com/org/repo.git, but not https://github.com/org2/repo.git.
+//
+// SCP-style URLs, e.g. git@github.com:org/, are matched as ssh:// URLs.
+//
+// Only the names of environment variables and files are recorded, the secrets
+// are read when they're needed, and are never stored in the configuration.
+//
+// HTTPS repositories authenticate with a username and password or token, SSH
+// repositories authenticate with a private key, and the host key is checked
+// against a known_hosts file.
+type Credential struct {
+	URL          string `json:"url"`
+	Username     string `json:"username,omitempty"` // Defaults to "git".
+	PasswordEnv  string `json:"password_env,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+
+	SSHKeyEnv           string `json:"ssh_key_env,omitempty"`
+	SSHKeyFile          string `json:"ssh_key_file,omitempty"`
+	SSHKeyPassphraseEnv string `json:"ssh_key_passphrase_env,omitempty"`
+	// KnownHostsFile defaults to the SSH_KNOWN_HOSTS environment variable, or
+	// ~/.ssh/known_hosts.
+	KnownHostsFile string `json:"known_hosts_file,omitempty"`
+}
+
+// AuthFor returns the authentication for a repository URL, or nil if no
+// credentials are configured for the URL.
+//
+// If more than one credential matches the URL, the one with the longest path
+// is used.
+func (c *Config) AuthFor(repoURL string) (transport.AuthMethod, error) {
+	u, ok := parseRepoURL(repoURL)
+	if !ok {
+		return nil, nil
+	}
+	var found *Credential
+	var foundURL *credentialURL
+	for _, v := range c.Credentials {
+		cu, ok := parseRepoURL(v.URL)
+		if !ok || !cu.contains(u) {
+			continue
+		}
+		if found == nil || len(cu.path) > len(foundURL.path) {
+			found, foundURL = v, cu
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found.AuthMethod()
+}
+
+// credentialURL is a repository URL split into the parts that credentials are
+// matched on.
+type credentialURL struct {
+	scheme string
+	host   string
+	path   []string
+}
+
+// contains returns true if u has the same scheme and host, and its path is
+// within the path of c, the paths are compared by segment.
+func (c *credentialURL) contains(u *credentialURL) bool {
+	if c.scheme != u.scheme || c.host != u.host || len(c.path) > len(u.path) {
+		return false
+	}
+	for i := range c.path {
+		if c.path[i] != u.path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRepoURL parses URLs with a scheme, and SCP-style URLs e.g.
+// git@github.com:org/repo.git, which are treated as ssh:// URLs.
+//
+// Local paths and URLs without a host are not parsed.
+func parseRepoURL(s string) (*credentialURL, bool) {
+	if !strings.Contains(s, "://") {
+		host, path, ok := strings.Cut(s, ":")
+		if !ok || strings.Contains(host, "/") {
+			return nil, false
+		}
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if host == "" {
+			return nil, false
+		}
+		return &credentialURL{scheme: "ssh", host: strings.ToLower(host), path: pathSegments(path)}, true
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, false
+	}
+	return &credentialURL{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Host), path: pathSegments(u.Path)}, true
+}
+
+// pathSegments splits a path into its non-empty segments.
+func pathSegments(path string) []string {
+	segments := []string{}
+	for _, v := range strings.Split(path, "/") {
+		if v != "" {
+			segments = append(segments, v)
+		}
+	}
+	return segments
+}
+
+// AuthMethod reads the secrets for the credential, and returns the go-git
+// authentication.
+func (c *Credential) AuthMethod() (transport.AuthMethod, error) {
+	username := c.Username
+	if username == "" {
+		username = defaultGitUsername
+	}
+	switch {
+	case c.SSHKeyEnv != "" || c.SSHKeyFile != "":
+		key, err := readSecret(c.SSHKeyEnv, c.SSHKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the SSH key for %s: %w", c.URL, err)
+		}
+		passphrase := ""
+		if c.SSHKeyPassphraseEnv != "" {
+			passphrase = os.Getenv(c.SSHKeyPassphraseEnv)
+		}
+		auth, err := gitssh.NewPublicKeys(username, key, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the SSH key for %s: %w", c.URL, err)
+		}
+		knownHosts := []string{}
+		if c.KnownHostsFile != "" {
+			knownHosts = append(knownHosts, c.KnownHostsFile)
+		}
+		callback, err := gitssh.NewKnownHostsCallback(knownHosts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known hosts for %s: %w", c.URL, err)
+		}
+		auth.HostKeyCallback = callback
+		return auth, nil
+	case c.PasswordEnv != "" || c.PasswordFile != "":
+		password, err := readSecret(c.PasswordEnv, c.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the password for %s: %w", c.URL, err)
+		}
+		return &githttp.BasicAuth{Username: username, Password: string(password)}, nil
+	default:
+		return nil, fmt.Errorf("credential for %s has no password or SSH key", c.URL)
+	}
+}
+
+// readSecret reads a secret from an environment variable, or if that's not
+// provided, a file, surrounding whitespace is removed.
+//
+// The secret is never included in the error.
+func readSecret(env, filename string) ([]byte, error) {
+	if env != "" {
+		v := strings.TrimSpace(os.Getenv(env))
+		if v == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", env)
+		}
+		return []byte(v), nil
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	b = []byte(strings.TrimSpace(string(b)))
+	if len(b) == 0 {
+		return nil, fmt.Errorf("file %s is empty", filename)
+	}
+	return b, nil
+}
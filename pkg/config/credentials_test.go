@@ -0,0 +1,230 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestAuthForWithNoMatchingCredentials(t *testing.T) {
+	cfg := &Config{
+		Credentials: []*Credential{
+			{URL: "https://github.com/private/", PasswordEnv: "TEST_TOKEN"},
+		},
+	}
+
+	auth, err := cfg.AuthFor("https://github.com/bigkevmcd/peanut.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != nil {
+		t.Fatalf("got %#v, want nil", auth)
+	}
+}
+
+func TestAuthForWithPasswordFromEnv(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "s3cret\n")
+	cfg := &Config{
+		Credentials: []*Credential{
+			{URL: "https://github.com/private/", PasswordEnv: "TEST_TOKEN"},
+		},
+	}
+
+	auth, err := cfg.AuthFor("https://github.com/private/gitops.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &githttp.BasicAuth{Username: "git", Password: "s3cret"}
+	assertCmp(t, want, auth, "failed to create auth")
+}
+
+func TestAuthForWithPasswordFromFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, "s3cret\n")
+	cfg := &Config{
+		Credentials: []*Credential{
+			{URL: "https://gitlab.com/", Username: "oauth2", PasswordFile: tokenFile},
+		},
+	}
+
+	auth, err := cfg.AuthFor("https://gitlab.com/private/gitops.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &githttp.BasicAuth{Username: "oauth2", Password: "s3cret"}
+	assertCmp(t, want, auth, "failed to create auth")
+}
+
+func TestAuthForUsesTheLongestMatch(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "s3cret")
+	t.Setenv("TEST_ORG_TOKEN", "0rg-s3cret")
+	cfg := &Config{
+		Credentials: []*Credential{
+			{URL: "https://github.com/", PasswordEnv: "TEST_TOKEN"},
+			{URL: "https://github.com/private/", PasswordEnv: "TEST_ORG_TOKEN"},
+		},
+	}
+
+	auth, err := cfg.AuthFor("https://github.com/private/gitops.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &githttp.BasicAuth{Username: "git", Password: "0rg-s3cret"}
+	assertCmp(t, want, auth, "failed to create auth")
+}
+
+func TestAuthForMatchesWholeHostsAndPaths(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "s3cret")
+	matchTests := []struct {
+		credURL string
+		repoURL string
+		want    bool
+	}{
+		{"https://git.example.com/", "https://git.example.com/org/repo.git", true},
+		{"https://git.example.com", "https://git.example.com/org/repo.git", true},
+		{"https://git.example.com/org/", "https://git.example.com/org/repo.git", true},
+		{"https://git.example.com/org", "https://git.example.com/org/repo.git", true},
+		{"https://GIT.example.com/org/", "https://git.example.com/org/repo.git", true},
+		{"git@github.com:", "git@github.com:org/repo.git", true},
+		{"git@github.com:org/", "ssh://git@github.com/org/repo.git", true},
+		{"https://git.example.com", "https://git.example.com.evil.io/x.git", false},
+		{"https://git.example.com/", "https://git.example.com.evil.io/x.git", false},
+		{"https://git.example.com/org", "https://git.example.com/org2/repo.git", false},
+		{"https://git.example.com/org/repo", "https://git.example.com/org/repo2.git", false},
+		{"https://git.example.com/", "http://git.example.com/org/repo.git", false},
+		{"https://git.example.com/", "git@git.example.com:org/repo.git", false},
+		{"git@github.com:", "git@github.com.evil.io:org/repo.git", false},
+		{"git@github.com:org", "git@github.com:org2/repo.git", false},
+		{"https://git.example.com/", "/src/git.example.com/repo", false},
+	}
+
+	for _, tt := range matchTests {
+		t.Run(tt.credURL+" "+tt.repoURL, func(t *testing.T) {
+			cfg := &Config{
+				Credentials: []*Credential{
+					{URL: tt.credURL, PasswordEnv: "TEST_TOKEN"},
+				},
+			}
+
+			auth, err := cfg.AuthFor(tt.repoURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := auth != nil; got != tt.want {
+				t.Fatalf("got match %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthForWithSSHKey(t *testing.T) {
+	dir := t.TempDir()
+	hostKey := generateSSHKey(t, filepath.Join(dir, "host_key"))
+	generateSSHKey(t, filepath.Join(dir, "id_ed25519"))
+	writeFile(t, filepath.Join(dir, "known_hosts"), knownhosts.Line([]string{"github.com"}, hostKey)+"\n")
+	cfg := &Config{
+		Credentials: []*Credential{
+			{
+				URL:            "git@github.com:",
+				SSHKeyFile:     filepath.Join(dir, "id_ed25519"),
+				KnownHostsFile: filepath.Join(dir, "known_hosts"),
+			},
+		},
+	}
+
+	auth, err := cfg.AuthFor("git@github.com:private/gitops.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, ok := auth.(*gitssh.PublicKeys)
+	if !ok {
+		t.Fatalf("got %T, want *ssh.PublicKeys", auth)
+	}
+	if keys.User != "git" {
+		t.Fatalf("got user %q, want %q", keys.User, "git")
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("140.82.121.4"), Port: 22}
+	if err := keys.HostKeyCallback("github.com:22", addr, hostKey); err != nil {
+		t.Fatalf("known host key was rejected: %s", err)
+	}
+	otherKey := generateSSHKey(t, filepath.Join(dir, "other_key"))
+	if err := keys.HostKeyCallback("github.com:22", addr, otherKey); err == nil {
+		t.Fatal("unknown host key was accepted")
+	}
+}
+
+func TestAuthForWithMissingSecrets(t *testing.T) {
+	missingTests := []struct {
+		name string
+		cred *Credential
+	}{
+		{"unset env", &Credential{URL: "https://github.com/", PasswordEnv: "TEST_UNSET_TOKEN"}},
+		{"missing file", &Credential{URL: "https://github.com/", PasswordFile: "/tmp/unknown/token"}},
+		{"missing SSH key", &Credential{URL: "git@github.com:", SSHKeyFile: "/tmp/unknown/id_rsa"}},
+		{"no secrets", &Credential{URL: "https://github.com/"}},
+	}
+
+	for _, tt := range missingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Credentials: []*Credential{tt.cred}}
+			_, err := cfg.AuthFor(tt.cred.URL + "private/gitops.git")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthErrorsDoNotIncludeSecrets(t *testing.T) {
+	t.Setenv("TEST_SSH_KEY", "s3cret-not-a-key")
+	cred := &Credential{URL: "git@github.com:", SSHKeyEnv: "TEST_SSH_KEY"}
+
+	_, err := cred.AuthMethod()
+	if err == nil {
+		t.Fatal("expected an error parsing an invalid key")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("error contains the secret: %s", err)
+	}
+}
+
+// generateSSHKey writes a new private key to a file, and returns the public
+// key.
+func generateSSHKey(t *testing.T, filename string) ssh.PublicKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filename, string(pem.EncodeToMemory(block)))
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, filename, body string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+// DesiredState is the state of the apps described by the manifests in an
+// app's repository.
+//
+// Apps are ordered by name, each app has an entry for every configured
+// environment, in the order they're configured, and the services within an
+// environment are ordered by name.
+type DesiredState struct {
+	Apps []*AppState `json:"apps"`
+}
+
+// App returns the named app, or nil if not found.
+func (d *DesiredState) App(name string) *AppState {
+	for _, v := range d.Apps {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// AppState is the desired state of an app across its environments.
+//
+// The app is identified by the app's configured Labels, by default this is
+// the "app.kubernetes.io/part-of" label on its services.
+type AppState struct {
+	Name         string              `json:"name"`
+	Environments []*EnvironmentState `json:"environments"`
+}
+
+// Environment returns the named environment, or nil if not found.
+func (a *AppState) Environment(name string) *EnvironmentState {
+	for _, v := range a.Environments {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// EnvironmentState is the desired state of the services in an environment.
+type EnvironmentState struct {
+	Name string `json:"name"`
+	// Path is the path of the kustomization within the repository.
+	Path string `json:"path"`
+	// Commit is the commit the manifests were parsed from, it's empty if the
+	// manifests were not read from a Git commit.
+	Commit   string            `json:"commit,omitempty"`
+	Services []*parser.Service `json:"services"`
+	// Warnings are problems with the resources in the environment, that
+	// meant that they were skipped, or only partially parsed.
+	Warnings []string `json:"warnings,omitempty"`
+	// Skipped are the workloads in the environment that couldn't be
+	// associated with an app.
+	Skipped []parser.Workload `json:"skipped,omitempty"`
+}
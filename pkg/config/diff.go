@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+// ErrUnknownEnvironment is returned when diffing an environment that isn't
+// configured.
+var ErrUnknownEnvironment = errors.New("unknown environment")
+
+// The changes to a service between two environments.
+const (
+	ServiceAdded   = "added"   // The service is only in the To environment.
+	ServiceRemoved = "removed" // The service is only in the From environment.
+	ServiceChanged = "changed"
+)
+
+// Diff is the difference between the services of an app in two
+// environments.
+//
+// Only the services that differ are included, ordered by name.
+type Diff struct {
+	App      string         `json:"app"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Services []*ServiceDiff `json:"services"`
+}
+
+// ServiceDiff is the difference between a service in two environments.
+//
+// Services that are only in one of the environments are "added" or
+// "removed", and the Service is the service from that environment, otherwise
+// the service is "changed", and the differences are recorded.
+type ServiceDiff struct {
+	Name      string           `json:"name"`
+	Change    string           `json:"change"`
+	Service   *parser.Service  `json:"service,omitempty"`
+	Namespace *NamespaceChange `json:"namespace,omitempty"`
+	Replicas  *ReplicasChange  `json:"replicas,omitempty"`
+	Images    []*ImageChange   `json:"images,omitempty"`
+}
+
+// NamespaceChange records a service in different namespaces.
+type NamespaceChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ReplicasChange records a service with different replicas.
+type ReplicasChange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// ImageChange records a difference in the images of a service, images are
+// compared by name, so a different tag or digest is a change, and From or To
+// is nil if the image is only used in one of the environments.
+type ImageChange struct {
+	Name string           `json:"name"`
+	From *image.Reference `json:"from,omitempty"`
+	To   *image.Reference `json:"to,omitempty"`
+}
+
+// DiffEnvironments compares the services of an app in two of its
+// environments.
+//
+// If either environment isn't in the state, the error is
+// ErrUnknownEnvironment.
+func DiffEnvironments(state *AppState, from, to string) (*Diff, error) {
+	fromEnv, toEnv := state.Environment(from), state.Environment(to)
+	for _, v := range []struct {
+		name string
+		env  *EnvironmentState
+	}{{from, fromEnv}, {to, toEnv}} {
+		if v.env == nil {
+			return nil, fmt.Errorf("%w %q in app %s", ErrUnknownEnvironment, v.name, state.Name)
+		}
+	}
+	return &Diff{
+		App:      state.Name,
+		From:     from,
+		To:       to,
+		Services: diffServices(fromEnv.Services, toEnv.Services),
+	}, nil
+}
+
+// diffServices matches the services by name and namespace, and then by name
+// alone, so that services are compared across namespaces.
+func diffServices(from, to []*parser.Service) []*ServiceDiff {
+	unmatched := append([]*parser.Service{}, to...)
+	take := func(svc *parser.Service, sameNamespace bool) *parser.Service {
+		for i, v := range unmatched {
+			if v.Name == svc.Name && (!sameNamespace || v.Namespace == svc.Namespace) {
+				unmatched = append(unmatched[:i], unmatched[i+1:]...)
+				return v
+			}
+		}
+		return nil
+	}
+	matches := make([]*parser.Service, len(from))
+	for i, svc := range from {
+		matches[i] = take(svc, true)
+	}
+	for i, svc := range from {
+		if matches[i] == nil {
+			matches[i] = take(svc, false)
+		}
+	}
+
+	diffs := []*ServiceDiff{}
+	for i, svc := range from {
+		if matches[i] == nil {
+			diffs = append(diffs, &ServiceDiff{Name: svc.Name, Change: ServiceRemoved, Service: svc})
+			continue
+		}
+		if d := diffService(svc, matches[i]); d != nil {
+			diffs = append(diffs, d)
+		}
+	}
+	for _, svc := range unmatched {
+		diffs = append(diffs, &ServiceDiff{Name: svc.Name, Change: ServiceAdded, Service: svc})
+	}
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+// diffService returns the differences between two versions of a service, or
+// nil if there are none.
+func diffService(from, to *parser.Service) *ServiceDiff {
+	d := &ServiceDiff{Name: from.Name, Change: ServiceChanged}
+	if from.Namespace != to.Namespace {
+		d.Namespace = &NamespaceChange{From: from.Namespace, To: to.Namespace}
+	}
+	if from.Replicas != to.Replicas {
+		d.Replicas = &ReplicasChange{From: from.Replicas, To: to.Replicas}
+	}
+	d.Images = diffImages(from.Images, to.Images)
+	if d.Namespace == nil && d.Replicas == nil && len(d.Images) == 0 {
+		return nil
+	}
+	return d
+}
+
+// diffImages pairs the images that are only in one of the environments by
+// name.
+func diffImages(from, to []image.Reference) []*ImageChange {
+	inFrom, inTo := map[image.Reference]bool{}, map[image.Reference]bool{}
+	for _, v := range from {
+		inFrom[v] = true
+	}
+	for _, v := range to {
+		inTo[v] = true
+	}
+	removed, added := map[string][]image.Reference{}, map[string][]image.Reference{}
+	names := map[string]bool{}
+	for _, v := range from {
+		if !inTo[v] {
+			removed[v.Name()] = append(removed[v.Name()], v)
+			names[v.Name()] = true
+		}
+	}
+	for _, v := range to {
+		if !inFrom[v] {
+			added[v.Name()] = append(added[v.Name()], v)
+			names[v.Name()] = true
+		}
+	}
+
+	var changes []*ImageChange
+	for _, name := range sortedNames(names) {
+		r, a := removed[name], added[name]
+		for i := 0; i < len(r) || i < len(a); i++ {
+			c := &ImageChange{Name: name}
+			if i < len(r) {
+				c.From = &r[i]
+			}
+			if i < len(a) {
+				c.To = &a[i]
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
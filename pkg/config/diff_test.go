@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+func TestDiffEnvironments(t *testing.T) {
+	app := &App{
+		Name: "go-demo",
+		Path: "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "staging", RelPath: "../overlays/staging"},
+			{Name: "production", RelPath: "../overlays/production"},
+		},
+	}
+	state, err := ParseManifestsFromFileSystem(app, gitfs.NewDir("../.."), plumbing.ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := DiffEnvironments(state.App("go-demo"), "staging", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staging, production := image.MustParse("bigkevmcd/go-demo:staging"), image.MustParse("bigkevmcd/go-demo:production")
+	want := &Diff{
+		App:  "go-demo",
+		From: "staging",
+		To:   "production",
+		Services: []*ServiceDiff{
+			{
+				Name:      "go-demo",
+				Change:    ServiceChanged,
+				Namespace: &NamespaceChange{From: "staging", To: "production"},
+				Images:    []*ImageChange{{Name: "docker.io/bigkevmcd/go-demo", From: &staging, To: &production}},
+			},
+			{
+				Name:      "redis",
+				Change:    ServiceChanged,
+				Namespace: &NamespaceChange{From: "staging", To: "production"},
+			},
+		},
+	}
+	assertCmp(t, want, diff, "failed to diff environments")
+}
+
+func TestDiffEnvironmentsWithUnknownEnvironment(t *testing.T) {
+	state := &AppState{Name: "go-demo", Environments: []*EnvironmentState{{Name: "dev"}}}
+
+	for _, envs := range [][2]string{{"dev", "production"}, {"production", "dev"}} {
+		_, err := DiffEnvironments(state, envs[0], envs[1])
+		if !errors.Is(err, ErrUnknownEnvironment) {
+			t.Errorf("DiffEnvironments(%q, %q) got %v, want ErrUnknownEnvironment", envs[0], envs[1], err)
+		}
+	}
+}
+
+func TestDiffServices(t *testing.T) {
+	svc := func(name, namespace string, replicas int64, refs ...string) *parser.Service {
+		return &parser.Service{Name: name, Namespace: namespace, Replicas: replicas, Images: images(refs...)}
+	}
+	ref := func(s string) *image.Reference {
+		r := image.MustParse(s)
+		return &r
+	}
+	from := []*parser.Service{
+		svc("api", "dev", 1, "example.com/api:v1", "example.com/proxy:v1"),
+		svc("old", "dev", 1, "example.com/old:v1"),
+		svc("same", "dev", 2, "example.com/same:v1"),
+		svc("worker", "dev", 1, "example.com/worker:v1"),
+		svc("worker", "jobs", 1, "example.com/worker:v1"),
+	}
+	to := []*parser.Service{
+		svc("api", "dev", 3, "example.com/api:v2", "example.com/metrics:v1"),
+		svc("new", "dev", 1, "example.com/new:v1"),
+		svc("same", "dev", 2, "example.com/same:v1"),
+		svc("worker", "jobs", 1, "example.com/worker:v1"),
+		svc("worker", "dev", 1, "example.com/worker@sha256:2f9bc84bb4c5ad7ba9b8b4fe1b1a6a8e3ee4d6c4b1a6e0e9b0c7ef4a4b5c6d7e"),
+	}
+
+	want := []*ServiceDiff{
+		{
+			Name:     "api",
+			Change:   ServiceChanged,
+			Replicas: &ReplicasChange{From: 1, To: 3},
+			Images: []*ImageChange{
+				{Name: "example.com/api", From: ref("example.com/api:v1"), To: ref("example.com/api:v2")},
+				{Name: "example.com/metrics", To: ref("example.com/metrics:v1")},
+				{Name: "example.com/proxy", From: ref("example.com/proxy:v1")},
+			},
+		},
+		{Name: "new", Change: ServiceAdded, Service: to[1]},
+		{Name: "old", Change: ServiceRemoved, Service: from[1]},
+		{
+			Name:   "worker",
+			Change: ServiceChanged,
+			Images: []*ImageChange{
+				{
+					Name: "example.com/worker",
+					From: ref("example.com/worker:v1"),
+					To:   ref("example.com/worker@sha256:2f9bc84bb4c5ad7ba9b8b4fe1b1a6a8e3ee4d6c4b1a6e0e9b0c7ef4a4b5c6d7e"),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, diffServices(from, to), "failed to diff services")
+}
@@ -1,52 +1,244 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"sort"
+	"sync"
 
 	"github.com/bigkevmcd/peanut/pkg/gitfs"
 	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 	"sigs.k8s.io/yaml"
 )
 
+// DefaultWorkers is the number of Kustomize builds that are run at the same
+// time when parsing manifests, unless another limit is provided.
+var DefaultWorkers = runtime.NumCPU()
+
 // ParseManifests parses the configuration's manifests into overall picture of
 // the repository's applications.
-// TODO: this should probably accept a fs.FileSystem to allow reusing the Git
-// clone.
-// TODO: This should also not be a map[string]map[string]map[string][]string :-)
-func ParseManifests(a *App) (map[string]map[string]map[string][]string, error) {
-	result := map[string]map[string]map[string][]string{}
-	gfs, err := gitfs.NewInMemoryFromOptions(&git.CloneOptions{
-		URL: a.RepoURL,
+//
+// The manifests are parsed at the app's configured Revision.
+func ParseManifests(a *App) (*DesiredState, error) {
+	return ParseManifestsAtRevision(a, a.Revision)
+}
+
+// ParseManifestsAtRevision parses the configuration's manifests at a specific
+// branch, tag or commit in the app's repository.
+func ParseManifestsAtRevision(a *App, rev string) (*DesiredState, error) {
+	return ParseManifestsWithAuth(a, rev, nil)
+}
+
+// ParseManifestsWithAuth parses the configuration's manifests at a specific
+// revision, authenticating the clone of the app's repository.
+//
+// Use Config.AuthFor to get the authentication for the app's RepoURL, local
+// repositories don't need authentication.
+func ParseManifestsWithAuth(a *App, rev string, auth transport.AuthMethod) (*DesiredState, error) {
+	if dir, ok := gitfs.LocalPath(a.RepoURL); ok {
+		gfs, commit, err := gitfs.NewLocal(dir, rev)
+		if err != nil {
+			return nil, err
+		}
+		return ParseManifestsFromFileSystem(a, gfs, commit)
+	}
+	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:  a.RepoURL,
+		Auth: auth,
 	})
 	if err != nil {
 		return nil, err
 	}
-	// TODO: This should probably reject data if the app is not the same as
-	// a.Name.
-	err = a.EachEnvironment(func(e *Environment) error {
-		parsed, err := parser.ParseConfig(e.Path(), gfs)
-		if err != nil {
-			return err
+	commit, err := gitfs.ResolveCommit(r, rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	gfs, err := gitfs.New(tree)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifestsFromFileSystem(a, gfs, commit.Hash)
+}
+
+// ParseManifestsFromFileSystem parses the configuration's manifests from an
+// existing filesystem, which allows a clone of the app's repository to be
+// reused.
+//
+// The commit is recorded as the source of the manifests, it can be
+// plumbing.ZeroHash if the files didn't come from a commit.
+//
+// The environments are parsed concurrently, with up to DefaultWorkers
+// Kustomize builds at the same time.
+func ParseManifestsFromFileSystem(a *App, gfs filesys.FileSystem, commit plumbing.Hash) (*DesiredState, error) {
+	return ParseManifestsConcurrently(a, gfs, commit, DefaultWorkers)
+}
+
+// ParseManifestsConcurrently parses the configuration's manifests from an
+// existing filesystem, with up to workers Kustomize builds running at the same
+// time.
+//
+// The environments share the filesystem, so it must be safe for concurrent
+// reads, the filesystems in the gitfs package are.
+//
+// If any environments fail to parse, the error joins an *EnvironmentError for
+// each of them, in the order that the environments are configured.
+func ParseManifestsConcurrently(a *App, gfs filesys.FileSystem, commit plumbing.Hash, workers int) (*DesiredState, error) {
+	return parseManifests(a, gfs, commit, newLimiter(workers))
+}
+
+// FileSystemFunc returns the filesystem to parse an app's manifests from, and
+// the commit that the files came from.
+type FileSystemFunc func(a *App) (filesys.FileSystem, plumbing.Hash, error)
+
+// ParseAllManifests parses the manifests for several apps concurrently, the
+// Kustomize builds for all of the apps share the limit of workers.
+//
+// The states are returned in the same order as the apps, if any apps fail,
+// the errors are joined, and the states for those apps are nil.
+func ParseAllManifests(apps []*App, fsFor FileSystemFunc, workers int) ([]*DesiredState, error) {
+	l := newLimiter(workers)
+	states := make([]*DesiredState, len(apps))
+	errs := make([]error, len(apps))
+	var wg sync.WaitGroup
+	for i, a := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gfs, commit, err := fsFor(a)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to read app %s: %w", a.Name, err)
+				return
+			}
+			states[i], errs[i] = parseManifests(a, gfs, commit, l)
+		}()
+	}
+	wg.Wait()
+	return states, errors.Join(errs...)
+}
+
+// EnvironmentError is returned when an app's environment can't be parsed.
+type EnvironmentError struct {
+	App         string
+	Environment string
+	Err         error
+}
+
+func (e *EnvironmentError) Error() string {
+	return fmt.Sprintf("failed to parse environment %s of app %s: %s", e.Environment, e.App, e.Err)
+}
+
+func (e *EnvironmentError) Unwrap() error {
+	return e.Err
+}
+
+func parseManifests(a *App, gfs filesys.FileSystem, commit plumbing.Hash, l limiter) (*DesiredState, error) {
+	parsed := make([]*parser.Config, len(a.Environments))
+	errs := make([]error, len(a.Environments))
+	var wg sync.WaitGroup
+	for i, e := range a.Environments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			defer l.release()
+			cfg, err := parser.ParseConfigWithLabels(a.environmentPath(e), gfs, a.labels())
+			if err != nil {
+				errs[i] = &EnvironmentError{App: a.Name, Environment: e.Name, Err: err}
+				return
+			}
+			if cfg == nil {
+				cfg = &parser.Config{}
+			}
+			parsed[i] = cfg
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return newDesiredState(a, parsed, commit), nil
+}
+
+// limiter is a counting semaphore that limits the number of Kustomize builds
+// that run at the same time.
+type limiter chan struct{}
+
+func newLimiter(n int) limiter {
+	if n < 1 {
+		n = 1
+	}
+	return make(limiter, n)
+}
+
+func (l limiter) acquire() {
+	l <- struct{}{}
+}
+
+func (l limiter) release() {
+	<-l
+}
+
+// newDesiredState arranges the configuration parsed from each of the app's
+// environments into apps.
+//
+// The configured app is always included, even if no services are labelled as
+// part of it.
+func newDesiredState(a *App, parsed []*parser.Config, commit plumbing.Hash) *DesiredState {
+	names := map[string]bool{a.Name: true}
+	for _, cfg := range parsed {
+		for _, v := range cfg.Apps {
+			names[v.Name] = true
 		}
-		for _, app := range parsed.Apps {
-			envs, ok := result[app.Name]
-			if !ok {
-				envs = map[string]map[string][]string{}
+	}
+	sha := ""
+	if !commit.IsZero() {
+		sha = commit.String()
+	}
+
+	state := &DesiredState{Apps: []*AppState{}}
+	for _, name := range sortedNames(names) {
+		app := &AppState{Name: name, Environments: []*EnvironmentState{}}
+		for i, e := range a.Environments {
+			env := &EnvironmentState{
+				Name:     e.Name,
+				Path:     a.environmentPath(e),
+				Commit:   sha,
+				Services: []*parser.Service{},
 			}
-			appSvcs := map[string][]string{}
-			for _, svc := range app.Services {
-				appSvcs[svc.Name] = svc.Images[:]
+			if parsedApp := parsed[i].App(name); parsedApp != nil {
+				env.Services = append(env.Services, parsedApp.Services...)
 			}
-			envs[e.Name] = appSvcs
-			result[app.Name] = envs
+			for _, w := range parsed[i].Warnings {
+				env.Warnings = append(env.Warnings, w.Error())
+			}
+			env.Skipped = parsed[i].Skipped
+			app.Environments = append(app.Environments, env)
 		}
-		return nil
-	})
-	return result, err
+		state.Apps = append(state.Apps, app)
+	}
+	return state
+}
+
+func sortedNames(m map[string]bool) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Parse decodes YAML describing an environment manifest.
@@ -61,6 +253,22 @@ func Parse(in io.Reader) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	for _, a := range m.Apps {
+		if err := a.labels().Validate(); err != nil {
+			return nil, fmt.Errorf("invalid labels for app %s: %w", a.Name, err)
+		}
+		if a.SCM != nil {
+			if err := a.SCM.validate(); err != nil {
+				return nil, fmt.Errorf("invalid SCM for app %s: %w", a.Name, err)
+			}
+		}
+		a.LinkEnvironments()
+	}
+	for _, v := range []*Identity{m.Author, m.Committer} {
+		if v != nil && (v.Name == "" || v.Email == "") {
+			return nil, errors.New("commit identities need a name and email")
+		}
+	}
 	return m, nil
 }
 
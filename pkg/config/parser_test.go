@@ -4,9 +4,19 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
 )
 
 func TestParseFile(t *testing.T) {
@@ -15,19 +25,43 @@ func TestParseFile(t *testing.T) {
 		want     *Config
 	}{
 		{"testdata/example1.yaml",
+			&Config{
+				Apps: []*App{
+					{
+						Name:     "go-demo",
+						RepoURL:  "https://github.com/bigkevmcd/go-demo.git",
+						Revision: "main",
+						Path:     "/examples/kustomize/base",
+						Environments: []*Environment{
+							{Name: "dev", RelPath: "../overlays/dev"},
+							{Name: "staging", RelPath: "../overlays/staging"},
+							{Name: "production", RelPath: "../overlays/production"},
+						},
+					},
+				},
+			},
+		},
+		{"testdata/example2.yaml",
 			&Config{
 				Apps: []*App{
 					{
 						Name:    "go-demo",
 						RepoURL: "https://github.com/bigkevmcd/go-demo.git",
 						Path:    "/examples/kustomize/base",
+						Labels:  &parser.Labels{App: "team", Service: "app", Fallback: parser.FallbackDirectory},
 						Environments: []*Environment{
 							{Name: "dev", RelPath: "../overlays/dev"},
-							{Name: "staging", RelPath: "../overlays/staging"},
-							{Name: "production", RelPath: "../overlays/production"},
 						},
 					},
 				},
+				Credentials: []*Credential{
+					{URL: "https://github.com/bigkevmcd/", PasswordEnv: "GITHUB_TOKEN"},
+					{
+						URL:            "git@gitlab.com:bigkevmcd/",
+						SSHKeyFile:     "/etc/peanut/ssh/id_ed25519",
+						KnownHostsFile: "/etc/peanut/ssh/known_hosts",
+					},
+				},
 			},
 		},
 	}
@@ -38,6 +72,9 @@ func TestParseFile(t *testing.T) {
 			if err != nil {
 				rt.Fatal(err)
 			}
+			for _, a := range tt.want.Apps {
+				a.LinkEnvironments()
+			}
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				rt.Errorf("Parse(%s) failed diff\n%s", tt.filename, diff)
 			}
@@ -70,6 +107,49 @@ func TestParseWithBadYAML(t *testing.T) {
 	}
 }
 
+func TestParseWithInvalidLabels(t *testing.T) {
+	_, err := Parse(strings.NewReader(`apps:
+- name: go-demo
+  labels:
+    fallback: unknown
+`))
+
+	if err == nil || !strings.Contains(err.Error(), "invalid labels for app go-demo") {
+		t.Fatalf("got %v, want an error identifying the app", err)
+	}
+}
+
+func TestParseWithInvalidSCM(t *testing.T) {
+	tests := []struct {
+		name    string
+		scm     string
+		wantErr string
+	}{
+		{"no token", "provider: github", "invalid SCM for app go-demo: no token_env or token_file"},
+		{"unknown provider", "provider: bitbucket\n    token_env: SCM_TOKEN", `invalid SCM for app go-demo: unknown provider "bitbucket"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader("apps:\n- name: go-demo\n  scm:\n    " + tt.scm + "\n"))
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWithIncompleteIdentity(t *testing.T) {
+	_, err := Parse(strings.NewReader(`author:
+  name: peanut
+`))
+
+	if err == nil || !strings.Contains(err.Error(), "need a name and email") {
+		t.Fatalf("got %v, want an error for the missing email", err)
+	}
+}
+
 func TestAppParseManifests(t *testing.T) {
 	goDemo := &App{
 		Name:    "go-demo",
@@ -86,16 +166,382 @@ func TestAppParseManifests(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := map[string]map[string]map[string][]string{
-		"go-demo": {
-			"dev":        {"go-demo-http": {"bigkevmcd/go-demo:latest"}, "redis": {"redis:6-alpine"}},
-			"production": {"go-demo-http": {"bigkevmcd/go-demo:production"}, "redis": {"redis:6-alpine"}},
-			"staging":    {"go-demo-http": {"bigkevmcd/go-demo:staging"}, "redis": {"redis:6-alpine"}},
+	head := headCommit(t)
+	want := &DesiredState{
+		Apps: []*AppState{
+			{
+				Name: "go-demo",
+				Environments: []*EnvironmentState{
+					{
+						Name:     "dev",
+						Path:     "pkg/config/testdata/go-demo/overlays/dev",
+						Commit:   head,
+						Services: goDemoServices("dev", "latest"),
+					},
+					{
+						Name:     "production",
+						Path:     "pkg/config/testdata/go-demo/overlays/production",
+						Commit:   head,
+						Services: goDemoServices("production", "production"),
+					},
+					{
+						Name:     "staging",
+						Path:     "pkg/config/testdata/go-demo/overlays/staging",
+						Commit:   head,
+						Services: goDemoServices("staging", "staging"),
+					},
+				},
+			},
 		},
 	}
 	assertCmp(t, want, all, "failed to parse manifests")
 }
 
+func TestAppParseManifestsAtRevision(t *testing.T) {
+	goDemo := &App{
+		Name:     "go-demo",
+		RepoURL:  "../..",
+		Revision: "HEAD",
+		Path:     "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "dev", RelPath: "../overlays/dev"},
+		},
+	}
+
+	all, err := ParseManifests(goDemo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*EnvironmentState{
+		{
+			Name:     "dev",
+			Path:     "pkg/config/testdata/go-demo/overlays/dev",
+			Commit:   headCommit(t),
+			Services: goDemoServices("dev", "latest"),
+		},
+	}
+	assertCmp(t, want, all.App("go-demo").Environments, "failed to parse manifests")
+
+	_, err = ParseManifestsAtRevision(goDemo, "unknown-branch")
+	if err == nil {
+		t.Fatal("expected an error parsing an unknown revision")
+	}
+}
+
+func TestAppParseManifestsFromLocalRepository(t *testing.T) {
+	goDemo := &App{
+		Name:    "go-demo",
+		RepoURL: "file://../..",
+		Path:    "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "production", RelPath: "../overlays/production"},
+		},
+	}
+
+	all, err := ParseManifests(goDemo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*EnvironmentState{
+		{
+			Name:     "production",
+			Path:     "pkg/config/testdata/go-demo/overlays/production",
+			Commit:   headCommit(t),
+			Services: goDemoServices("production", "production"),
+		},
+	}
+	assertCmp(t, want, all.App("go-demo").Environments, "failed to parse manifests")
+}
+
+func TestParseManifestsFromFileSystemIncludesUnlabelledApps(t *testing.T) {
+	app := &App{
+		Name: "unknown",
+		Path: "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "dev", RelPath: "../overlays/dev"},
+			{Name: "staging", RelPath: "../overlays/staging"},
+		},
+	}
+
+	all, err := ParseManifestsFromFileSystem(app, gitfs.NewDir("../.."), plumbing.ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &DesiredState{
+		Apps: []*AppState{
+			{
+				Name: "go-demo",
+				Environments: []*EnvironmentState{
+					{Name: "dev", Path: "pkg/config/testdata/go-demo/overlays/dev", Services: goDemoServices("dev", "latest")},
+					{Name: "staging", Path: "pkg/config/testdata/go-demo/overlays/staging", Services: goDemoServices("staging", "staging")},
+				},
+			},
+			{
+				Name: "unknown",
+				Environments: []*EnvironmentState{
+					{Name: "dev", Path: "pkg/config/testdata/go-demo/overlays/dev", Services: []*parser.Service{}},
+					{Name: "staging", Path: "pkg/config/testdata/go-demo/overlays/staging", Services: []*parser.Service{}},
+				},
+			},
+		},
+	}
+	assertCmp(t, want, all, "failed to parse manifests")
+}
+
+func TestParseManifestsRecordsWarnings(t *testing.T) {
+	app := &App{
+		Name:         "broken",
+		Path:         "pkg/kustomize/parser/testdata/broken",
+		Environments: []*Environment{{Name: "dev", RelPath: "."}},
+	}
+
+	all, err := ParseManifestsFromFileSystem(app, gitfs.NewDir("../.."), plumbing.ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := all.App("broken").Environment("dev")
+	if l := len(env.Services); l != 2 {
+		t.Fatalf("got %d services, want 2", l)
+	}
+	if l := len(env.Warnings); l != 4 {
+		t.Fatalf("got %d warnings, want 4: %v", l, env.Warnings)
+	}
+}
+
+func TestParseManifestsWithLabels(t *testing.T) {
+	app := &App{
+		Name:         "payments",
+		Path:         "pkg/kustomize/parser/testdata/labels",
+		Labels:       &parser.Labels{App: "team", Service: "app"},
+		Environments: []*Environment{{Name: "dev", RelPath: "."}},
+	}
+
+	all, err := ParseManifestsFromFileSystem(app, gitfs.NewDir("../.."), plumbing.ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := all.App("payments").Environment("dev")
+	names := []string{}
+	for _, svc := range env.Services {
+		names = append(names, svc.Name)
+	}
+	assertCmp(t, []string{"api", "payments-worker"}, names, "failed to identify services")
+	want := []parser.Workload{{Kind: "Deployment", Name: "unowned", Namespace: "labels"}}
+	assertCmp(t, want, env.Skipped, "failed to report skipped workloads")
+}
+
+func TestParseManifestsWithDirectoryFallback(t *testing.T) {
+	app := &App{
+		Name:   "payments",
+		Path:   "pkg/config/testdata/unlabelled/base",
+		Labels: &parser.Labels{Fallback: parser.FallbackDirectory},
+		Environments: []*Environment{
+			{Name: "dev", RelPath: "../overlays/dev"},
+			{Name: "production", RelPath: "../overlays/production"},
+		},
+	}
+
+	all, err := ParseManifestsFromFileSystem(app, gitfs.NewDir("../.."), plumbing.ZeroHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, v := range all.Apps {
+		names = append(names, v.Name)
+	}
+	assertCmp(t, []string{"payments"}, names, "failed to identify the apps")
+	for _, env := range all.App("payments").Environments {
+		if l := len(env.Services); l != 1 || env.Services[0].Name != "payments-api" {
+			t.Errorf("environment %s got services %#v, want payments-api", env.Name, env.Services)
+		}
+		if l := len(env.Skipped); l != 0 {
+			t.Errorf("environment %s skipped %d workloads, want 0", env.Name, l)
+		}
+	}
+}
+
+func TestParseManifestsConcurrently(t *testing.T) {
+	app := &App{
+		Name: "go-demo",
+		Path: "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "dev", RelPath: "../overlays/dev"},
+			{Name: "staging", RelPath: "../overlays/staging"},
+			{Name: "production", RelPath: "../overlays/production"},
+		},
+	}
+	gfs := gitfs.NewDir("../..")
+
+	want, err := ParseManifestsConcurrently(app, gfs, plumbing.ZeroHash, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 2, 10} {
+		got, err := ParseManifestsConcurrently(app, gfs, plumbing.ZeroHash, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertCmp(t, want, got, fmt.Sprintf("parsing with %d workers", workers))
+	}
+}
+
+func TestParseManifestsConcurrentlyWithErrors(t *testing.T) {
+	app := &App{
+		Name: "go-demo",
+		Path: "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{
+			{Name: "dev", RelPath: "../overlays/dev"},
+			{Name: "unknown1", RelPath: "../overlays/unknown1"},
+			{Name: "unknown2", RelPath: "../overlays/unknown2"},
+		},
+	}
+
+	_, err := ParseManifestsConcurrently(app, gitfs.NewDir("../.."), plumbing.ZeroHash, 2)
+
+	var envErr *EnvironmentError
+	if !errors.As(err, &envErr) {
+		t.Fatalf("got %v, want an EnvironmentError", err)
+	}
+	if envErr.Environment != "unknown1" {
+		t.Fatalf("got environment %q, want %q", envErr.Environment, "unknown1")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "environment unknown1 of app go-demo") || !strings.Contains(msg, "environment unknown2 of app go-demo") {
+		t.Fatalf("error didn't identify the failed environments: %s", msg)
+	}
+	if strings.Index(msg, "unknown1") > strings.Index(msg, "unknown2") {
+		t.Fatalf("errors were not in environment order: %s", msg)
+	}
+}
+
+func TestParseAllManifests(t *testing.T) {
+	goDemo := &App{
+		Name:         "go-demo",
+		Path:         "pkg/config/testdata/go-demo/base",
+		Environments: []*Environment{{Name: "dev", RelPath: "../overlays/dev"}},
+	}
+	broken := &App{Name: "broken"}
+	testErr := errors.New("failed to clone")
+	fsFor := func(a *App) (filesys.FileSystem, plumbing.Hash, error) {
+		if a == broken {
+			return nil, plumbing.ZeroHash, testErr
+		}
+		return gitfs.NewDir("../.."), plumbing.ZeroHash, nil
+	}
+
+	states, err := ParseAllManifests([]*App{goDemo, broken, goDemo}, fsFor, 2)
+	if !errors.Is(err, testErr) {
+		t.Fatalf("got %v, want %v", err, testErr)
+	}
+	if len(states) != 3 || states[1] != nil {
+		t.Fatalf("got %#v, want a nil state for the failed app", states)
+	}
+	for _, i := range []int{0, 2} {
+		assertCmp(t, goDemoServices("dev", "latest"), states[i].App("go-demo").Environments[0].Services, "failed to parse manifests")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(3)
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			defer l.release()
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning > 3 {
+		t.Fatalf("got %d running at the same time, want no more than 3", maxRunning)
+	}
+}
+
+func goDemoServices(namespace, tag string) []*parser.Service {
+	return []*parser.Service{
+		{
+			Name:      "go-demo",
+			Kind:      "Deployment",
+			Namespace: namespace,
+			Replicas:  1,
+			Images:    images("bigkevmcd/go-demo:" + tag),
+			Components: []*parser.Component{
+				{Kind: "Deployment", Name: "go-demo-http", Replicas: 1, Images: images("bigkevmcd/go-demo:" + tag)},
+			},
+			Containers: []*parser.Container{
+				{
+					Name:      "http",
+					Role:      parser.RoleMain,
+					Image:     image.MustParse("bigkevmcd/go-demo:" + tag),
+					ImageName: "bigkevmcd/go-demo:" + tag,
+					Ports:     []parser.Port{{ContainerPort: 8080}},
+					EnvFrom:   []string{"configmap/go-demo-config"},
+				},
+			},
+		},
+		{
+			Name:      "redis",
+			Kind:      "Deployment",
+			Namespace: namespace,
+			Replicas:  1,
+			Images:    images("redis:6-alpine"),
+			Components: []*parser.Component{
+				{Kind: "Deployment", Name: "redis", Replicas: 1, Images: images("redis:6-alpine")},
+			},
+			Containers: []*parser.Container{
+				{
+					Name:      "redis",
+					Role:      parser.RoleMain,
+					Image:     image.MustParse("redis:6-alpine"),
+					ImageName: "redis:6-alpine",
+					Ports:     []parser.Port{{ContainerPort: 6379}},
+					Resources: &parser.Resources{Requests: map[string]string{"cpu": "100m", "memory": "100Mi"}},
+				},
+			},
+		},
+	}
+}
+
+// headCommit returns the commit that clones of this repository will be at.
+func headCommit(t *testing.T) string {
+	t.Helper()
+	r, err := git.PlainOpen("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Hash().String()
+}
+
+func images(refs ...string) []image.Reference {
+	parsed := make([]image.Reference, len(refs))
+	for i, v := range refs {
+		parsed[i] = image.MustParse(v)
+	}
+	return parsed
+}
+
 func assertCmp(t *testing.T, want, got interface{}, msg string) {
 	t.Helper()
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bigkevmcd/peanut/pkg/scm"
+)
+
+// ErrNoSCM is returned when opening pull requests for an app without an SCM
+// configuration.
+var ErrNoSCM = errors.New("no SCM provider is configured")
+
+// SCM configures the API of the service that hosts an app's repository,
+// which is used to open pull requests.
+//
+// The Provider is "github" or "gitlab", the URL defaults to the provider's
+// public API, and the Repository defaults to the path of the app's RepoURL,
+// e.g. "my-org/my-repo".
+//
+// As with credentials, only the name of the environment variable or file
+// with the token is recorded.
+type SCM struct {
+	Provider   string `json:"provider"`
+	URL        string `json:"url,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	TokenEnv   string `json:"token_env,omitempty"`
+	TokenFile  string `json:"token_file,omitempty"`
+}
+
+// validate checks that the provider is known, and that a token is configured.
+func (s *SCM) validate() error {
+	switch s.Provider {
+	case scm.GitHub, scm.GitLab:
+	default:
+		return fmt.Errorf("unknown provider %q, use %q or %q", s.Provider, scm.GitHub, scm.GitLab)
+	}
+	if s.TokenEnv == "" && s.TokenFile == "" {
+		return errors.New("no token_env or token_file is configured for the token")
+	}
+	return nil
+}
+
+// SCMProvider returns the provider for the app's repository, and the path of
+// the repository within the provider.
+//
+// If the app has no SCM configuration, the error is ErrNoSCM.
+func (a *App) SCMProvider() (scm.Provider, string, error) {
+	if a.SCM == nil {
+		return nil, "", fmt.Errorf("%w for app %s", ErrNoSCM, a.Name)
+	}
+	if err := a.SCM.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid SCM for app %s: %w", a.Name, err)
+	}
+	repo := a.SCM.Repository
+	if repo == "" {
+		var err error
+		repo, err = scm.RepositoryFromURL(a.RepoURL)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	token, err := readSecret(a.SCM.TokenEnv, a.SCM.TokenFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the SCM token for app %s: %w", a.Name, err)
+	}
+	p, err := scm.New(a.SCM.Provider, a.SCM.URL, string(token), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, repo, nil
+}
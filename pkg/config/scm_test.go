@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSCMProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/my-org/my-repo" || r.Header.Get("Authorization") != "Bearer test-token" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"default_branch": "main"}`))
+	}))
+	t.Cleanup(ts.Close)
+	t.Setenv("TEST_SCM_TOKEN", "test-token")
+	app := &App{
+		Name:    "go-demo",
+		RepoURL: "git@github.com:my-org/my-repo.git",
+		SCM:     &SCM{Provider: "github", URL: ts.URL, TokenEnv: "TEST_SCM_TOKEN"},
+	}
+
+	p, repo, err := app.SCMProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if repo != "my-org/my-repo" {
+		t.Fatalf("got repository %q, want %q", repo, "my-org/my-repo")
+	}
+	branch, err := p.DefaultBranch(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch != "main" {
+		t.Fatalf("got branch %q, want %q", branch, "main")
+	}
+}
+
+func TestSCMProviderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		scm  *SCM
+	}{
+		{"no configuration", nil},
+		{"missing token", &SCM{Provider: "github", TokenEnv: "TEST_UNSET_SCM_TOKEN"}},
+		{"no token", &SCM{Provider: "github"}},
+		{"unknown provider", &SCM{Provider: "unknown", Repository: "my-org/my-repo", TokenEnv: "TEST_SCM_TOKEN"}},
+	}
+	t.Setenv("TEST_SCM_TOKEN", "test-token")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{Name: "go-demo", RepoURL: "https://github.com/my-org/my-repo.git", SCM: tt.scm}
+
+			if _, _, err := app.SCMProvider(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	_, _, err := (&App{Name: "go-demo"}).SCMProvider()
+	if !errors.Is(err, ErrNoSCM) {
+		t.Fatalf("got error %v, want %v", err, ErrNoSCM)
+	}
+}
@@ -0,0 +1,165 @@
+package gitfs
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// dirFS is a read-only filesystem for the files in a directory on disk, the
+// paths are relative to the directory, in the same way that the paths in a
+// gitFS are relative to the root of the repository.
+type dirFS struct {
+	root string
+	disk filesys.FileSystem
+}
+
+// NewDir returns a read-only filesystem with the files in a directory on disk,
+// for example, a checked-out repository.
+//
+// Paths are resolved relative to the directory, "/" is the directory itself,
+// and paths can't escape from the directory with "..".
+func NewDir(root string) filesys.FileSystem {
+	return &dirFS{root: root, disk: filesys.MakeFsOnDisk()}
+}
+
+// ReadDir implements filesys.FileSystem.
+//
+// The names of the entries in the directory are returned in lexical order.
+func (d *dirFS) ReadDir(name string) ([]string, error) {
+	return d.readDir("readdir", name)
+}
+
+// IsDir implements filesys.FileSystem.
+func (d *dirFS) IsDir(name string) bool {
+	return d.disk.IsDir(d.join(name))
+}
+
+// CleanedAbs implements filesys.FileSystem.
+func (d *dirFS) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
+	if d.IsDir(p) {
+		return filesys.ConfirmedDir(p), "", nil
+	}
+	return filesys.ConfirmedDir(path.Dir(p)), path.Base(p), nil
+}
+
+// ReadFile implements filesys.FileSystem.
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	b, err := d.disk.ReadFile(d.join(name))
+	if err != nil {
+		return nil, d.pathError(err, name)
+	}
+	return b, nil
+}
+
+// Walk implements filesys.FileSystem.
+//
+// The directory is walked in lexical order, in the same way as filepath.Walk.
+func (d *dirFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	return walk(d, root, walkFn)
+}
+
+// Create implements filesys.FileSystem.
+func (d *dirFS) Create(name string) (filesys.File, error) {
+	return nil, errNotSupported("Create")
+}
+
+// MkDir implements filesys.FileSystem.
+func (d *dirFS) Mkdir(name string) error {
+	return errNotSupported("MkDir")
+}
+
+// MkDirAll implements filesys.FileSystem.
+func (d *dirFS) MkdirAll(name string) error {
+	return errNotSupported("MkdirAll")
+}
+
+// RemoveAll implements filesys.FileSystem.
+func (d *dirFS) RemoveAll(name string) error {
+	return errNotSupported("RemoveAll")
+}
+
+// Open implements filesys.FileSystem.
+//
+// The returned file is read-only.
+func (d *dirFS) Open(name string) (filesys.File, error) {
+	f, err := os.Open(d.join(name))
+	if err != nil {
+		return nil, d.pathError(err, name)
+	}
+	return readOnlyFile{f}, nil
+}
+
+// Exists implements filesys.FileSystem.
+func (d *dirFS) Exists(name string) bool {
+	return d.disk.Exists(d.join(name))
+}
+
+// Glob implements filesys.FileSystem.
+//
+// This follows the same rules as filepath.Glob, the only possible returned
+// error is path.ErrBadPattern.
+func (d *dirFS) Glob(pattern string) ([]string, error) {
+	return glob(d, pattern)
+}
+
+// WriteFile implements filesys.FileSystem.
+func (d *dirFS) WriteFile(name string, data []byte) error {
+	return errNotSupported("WriteFile")
+}
+
+func (d *dirFS) readDir(op, name string) ([]string, error) {
+	entries, err := os.ReadDir(d.join(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+	names := make([]string, len(entries))
+	for i, v := range entries {
+		names[i] = v.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d *dirFS) stat(op, name string) (os.FileInfo, error) {
+	info, err := os.Stat(d.join(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+	return info, nil
+}
+
+// join returns the path on disk for a path within the directory.
+func (d *dirFS) join(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(cleanPath(name)))
+}
+
+// pathError reports errors with the path within the directory, rather than
+// the path on disk.
+func (d *dirFS) pathError(err error, name string) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// readOnlyFile wraps a file on disk, and rejects writes.
+type readOnlyFile struct {
+	*os.File
+}
+
+// Write implements io.Writer.
+func (f readOnlyFile) Write(p []byte) (int, error) {
+	return 0, errNotSupported("Write")
+}
@@ -0,0 +1,242 @@
+package gitfs
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var _ filesys.FileSystem = &dirFS{}
+var _ filesys.File = readOnlyFile{}
+
+func TestDirUnsupportedFeatures(t *testing.T) {
+	d := NewDir(t.TempDir())
+
+	_, err := d.Create("testing/file")
+	assertIsUnsupported(t, err)
+	assertIsUnsupported(t, d.Mkdir("testing"))
+	assertIsUnsupported(t, d.MkdirAll("testing/testing"))
+	assertIsUnsupported(t, d.RemoveAll("testing/testing"))
+	assertIsUnsupported(t, d.WriteFile("testing", []byte("testing")))
+}
+
+func TestDirReadFile(t *testing.T) {
+	d := NewDir(makeTestDir(t))
+
+	for _, name := range []string{"base/deployment.yaml", "/base/deployment.yaml", "../base/deployment.yaml"} {
+		b, err := d.ReadFile(name)
+		assertNoError(t, err)
+		if diff := cmp.Diff("kind: Deployment\n", string(b)); diff != "" {
+			t.Fatalf("failed to read %q:\n%s", name, diff)
+		}
+	}
+
+	_, err := d.ReadFile("base/unknown.yaml")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestDirReadDir(t *testing.T) {
+	d := NewDir(makeTestDir(t))
+
+	names, err := d.ReadDir("/")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"base", "overlays", "top.yaml"}, names); diff != "" {
+		t.Fatalf("failed to read dir:\n%s", diff)
+	}
+	if !d.IsDir("overlays/dev") || d.IsDir("top.yaml") {
+		t.Fatal("IsDir() didn't identify the directories")
+	}
+	if !d.Exists("overlays/dev/kustomization.yaml") || d.Exists("overlays/prod") {
+		t.Fatal("Exists() didn't identify the files")
+	}
+}
+
+func TestDirOpen(t *testing.T) {
+	d := NewDir(makeTestDir(t))
+
+	f, err := d.Open("top.yaml")
+	assertNoError(t, err)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: Top\n", string(b)); diff != "" {
+		t.Fatalf("failed to read file:\n%s", diff)
+	}
+	_, err = f.Write([]byte("testing"))
+	assertIsUnsupported(t, err)
+}
+
+func TestDirWalkAndGlob(t *testing.T) {
+	d := NewDir(makeTestDir(t))
+
+	walked := []string{}
+	err := d.Walk("overlays", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	assertNoError(t, err)
+	want := []string{
+		"overlays",
+		"overlays/dev",
+		"overlays/dev/kustomization.yaml",
+		"overlays/staging",
+		"overlays/staging/kustomization.yaml",
+	}
+	if diff := cmp.Diff(want, walked); diff != "" {
+		t.Fatalf("walk failed:\n%s", diff)
+	}
+
+	got, err := d.Glob("overlays/*/kustomization.yaml")
+	assertNoError(t, err)
+	want = []string{"overlays/dev/kustomization.yaml", "overlays/staging/kustomization.yaml"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("glob failed:\n%s", diff)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	localTests := []struct {
+		url      string
+		wantPath string
+		wantOK   bool
+	}{
+		{"file:///srv/repos/gitops.git", "/srv/repos/gitops.git", true},
+		{"file://../..", "../..", true},
+		{"https://github.com/bigkevmcd/peanut.git", "", false},
+		{"../..", "", false},
+	}
+
+	for _, tt := range localTests {
+		p, ok := LocalPath(tt.url)
+		if p != tt.wantPath || ok != tt.wantOK {
+			t.Errorf("LocalPath(%q) got %q, %v, want %q, %v", tt.url, p, ok, tt.wantPath, tt.wantOK)
+		}
+	}
+}
+
+func TestNewLocalReadsTheWorkingDirectory(t *testing.T) {
+	dir, _, second := makeTestRepository(t)
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), "version: 3\n")
+
+	gfs, commit, err := NewLocal(dir, "")
+	assertNoError(t, err)
+
+	if commit != second {
+		t.Fatalf("got commit %s, want %s", commit, second)
+	}
+	assertFileContents(t, gfs, "config.yaml", "version: 3\n")
+}
+
+func TestNewLocalAtRevision(t *testing.T) {
+	dir, first, second := makeTestRepository(t)
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), "version: 3\n")
+
+	revTests := []struct {
+		rev  string
+		want plumbing.Hash
+		body string
+	}{
+		{"HEAD", second, "version: 2\n"},
+		{"release-1.4", first, "version: 1\n"},
+		{"v1.4.1", first, "version: 1\n"},
+	}
+
+	for _, tt := range revTests {
+		gfs, commit, err := NewLocal(dir, tt.rev)
+		assertNoError(t, err)
+		if commit != tt.want {
+			t.Errorf("%s got commit %s, want %s", tt.rev, commit, tt.want)
+		}
+		assertFileContents(t, gfs, "config.yaml", tt.body)
+	}
+
+	if _, _, err := NewLocal(dir, "unknown-branch"); !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		t.Fatalf("got %v, want plumbing.ErrReferenceNotFound", err)
+	}
+}
+
+func TestNewLocalWithBareRepository(t *testing.T) {
+	dir, _, second := makeTestRepository(t)
+	bare := filepath.Join(t.TempDir(), "bare.git")
+	_, err := git.PlainClone(bare, true, &git.CloneOptions{URL: dir})
+	assertNoError(t, err)
+
+	gfs, commit, err := NewLocal(bare, "")
+	assertNoError(t, err)
+
+	if commit != second {
+		t.Fatalf("got commit %s, want %s", commit, second)
+	}
+	assertFileContents(t, gfs, "config.yaml", "version: 2\n")
+}
+
+func TestNewLocalWithDirectory(t *testing.T) {
+	dir := makeTestDir(t)
+
+	gfs, commit, err := NewLocal(dir, "")
+	assertNoError(t, err)
+
+	if !commit.IsZero() {
+		t.Fatalf("got commit %s for a directory", commit)
+	}
+	assertFileContents(t, gfs, "top.yaml", "kind: Top\n")
+
+	if _, _, err := NewLocal(dir, "main"); err == nil {
+		t.Fatal("expected an error reading a revision of a directory")
+	}
+}
+
+func TestNewLocalWithMissingDirectory(t *testing.T) {
+	_, _, err := NewLocal(filepath.Join(t.TempDir(), "unknown"), "")
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+// makeTestDir creates a directory on disk with a similar layout to
+// makeTestTree.
+func makeTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"top.yaml":                            "kind: Top\n",
+		"base/deployment.yaml":                "kind: Deployment\n",
+		"base/kustomization.yaml":             "resources: []\n",
+		"overlays/dev/kustomization.yaml":     "resources: []\n",
+		"overlays/staging/kustomization.yaml": "resources: []\n",
+	}
+	for k, v := range files {
+		name := filepath.Join(dir, filepath.FromSlash(k))
+		assertNoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		writeTestFile(t, name, v)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, name, body string) {
+	t.Helper()
+	assertNoError(t, os.WriteFile(name, []byte(body), 0644))
+}
+
+func assertFileContents(t *testing.T, fs filesys.FileSystem, name, want string) {
+	t.Helper()
+	b, err := fs.ReadFile(name)
+	assertNoError(t, err)
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("incorrect contents for %s:\n%s", name, diff)
+	}
+}
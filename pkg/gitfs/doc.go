@@ -1,9 +1,11 @@
-package gitfs
-
-// This is an implementation of the Kustomize fs.FileSystem implementation,
-// which uses go-git to fetch the files.
+// Package gitfs implements the Kustomize filesys.FileSystem, with go-git to
+// read the files in a Git tree.
 //
-// It is not a complete implementation of fs.FileSystem, only the necessary
-// methods to allow Kustomize to build manifests.
+// The filesystems returned from New, and the other constructors that read
+// from a repository, and NewDir, which reads a directory on disk, are
+// read-only, the methods that would modify them return an error.
 //
-// This is a lesson in the Interface Seggregation principal...
+// An Overlay adds writes on top of a read-only filesystem, the writes are
+// recorded in memory, so that kustomizations can be changed and rebuilt
+// before the changes are committed.
+package gitfs
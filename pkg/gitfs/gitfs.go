@@ -1,14 +1,20 @@
 package gitfs
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
+	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
@@ -16,71 +22,171 @@ import (
 // gitFS is an internal implementation of the Kustomize
 // filesystem abstraction.
 type gitFS struct {
+	// mu guards tree, which caches lookups and isn't safe for concurrent use.
+	mu   sync.Mutex
 	tree *object.Tree
+
+	index dirIndex
 }
 
+const localScheme = "file://"
+
 // New creates and returns a go-git storage adapter.
-func New(t *object.Tree) filesys.FileSystem {
-	return &gitFS{tree: t}
+//
+// The directories in the tree are indexed up front, so that reading the tree
+// fails here, rather than in the filesystem's methods.
+func New(t *object.Tree) (filesys.FileSystem, error) {
+	idx, err := buildDirIndex(t)
+	if err != nil {
+		return nil, err
+	}
+	return &gitFS{tree: t, index: idx}, nil
 }
 
 // NewInMemoryFromOptions clones a Git repository into memory.
+//
+// Private repositories can be cloned by setting Auth in the options.
 func NewInMemoryFromOptions(opts *git.CloneOptions) (filesys.FileSystem, error) {
+	return NewInMemoryAtRevision(opts, "")
+}
+
+// NewInMemoryAtRevision clones a Git repository into memory, and returns the
+// files at a specific revision.
+//
+// The revision can be a branch, tag or commit SHA, the HEAD of the repository
+// is used if the revision is empty.
+func NewInMemoryAtRevision(opts *git.CloneOptions, rev string) (filesys.FileSystem, error) {
 	clone, err := git.Clone(memory.NewStorage(), nil, opts)
 	if err != nil {
 		return nil, err
 	}
-	ref, err := clone.Head()
+	return NewFromRepository(clone, rev)
+}
+
+// NewFromRepository returns the files at a specific revision of an existing
+// repository.
+func NewFromRepository(r *git.Repository, rev string) (filesys.FileSystem, error) {
+	commit, err := ResolveCommit(r, rev)
 	if err != nil {
 		return nil, err
 	}
-	commit, err := clone.CommitObject(ref.Hash())
+	tree, err := commit.Tree()
 	if err != nil {
 		return nil, err
 	}
+	return New(tree)
+}
 
+// LocalPath returns the path of a repository URL with the "file://" scheme,
+// and false if the URL is for a remote repository.
+//
+// Relative paths are accepted, "file://testdata/repo" is the path
+// "testdata/repo".
+func LocalPath(url string) (string, bool) {
+	if !strings.HasPrefix(url, localScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, localScheme), true
+}
+
+// NewLocal returns the files at a revision of a repository on disk, along
+// with the commit that the revision resolved to, the repository is opened in
+// place rather than cloned.
+//
+// If the revision is empty, the files in a checked-out repository are read
+// directly from the disk, including any uncommitted changes, and the commit is
+// the current HEAD. Directories that are not Git repositories can also be read
+// this way, and have no commit.
+//
+// Bare repositories, and non-empty revisions are read from the Git objects.
+func NewLocal(dir, rev string) (filesys.FileSystem, plumbing.Hash, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		if err == git.ErrRepositoryNotExists && rev == "" {
+			if info, statErr := os.Stat(dir); statErr != nil || !info.IsDir() {
+				return nil, plumbing.ZeroHash, fmt.Errorf("failed to open %s: %w", dir, fs.ErrNotExist)
+			}
+			return NewDir(dir), plumbing.ZeroHash, nil
+		}
+		return nil, plumbing.ZeroHash, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	if rev == "" {
+		if wt, err := r.Worktree(); err == nil {
+			head := plumbing.ZeroHash
+			if ref, err := r.Head(); err == nil {
+				head = ref.Hash()
+			}
+			return NewDir(wt.Filesystem.Root()), head, nil
+		}
+	}
+	commit, err := ResolveCommit(r, rev)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
 	tree, err := commit.Tree()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	gfs, err := New(tree)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	return gfs, commit.Hash, nil
+}
+
+// ResolveCommit finds the commit for a revision in a repository.
+//
+// The revision can be a branch, tag or commit SHA, the HEAD of the repository
+// is used if the revision is empty.
+//
+// Branches that only exist in a remote are resolved, so "release-1.4" will
+// find "origin/release-1.4" in a clone.
+func ResolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	if rev == "" {
+		ref, err := r.Head()
+		if err != nil {
+			return nil, err
+		}
+		return r.CommitObject(ref.Hash())
+	}
+	candidates := []string{rev}
+	remotes, err := r.Remotes()
 	if err != nil {
 		return nil, err
 	}
-	return New(tree), nil
+	for _, v := range remotes {
+		candidates = append(candidates, v.Config().Name+"/"+rev)
+	}
+	for _, v := range candidates {
+		h, err := r.ResolveRevision(plumbing.Revision(v))
+		if err == nil {
+			return r.CommitObject(*h)
+		}
+		if err != plumbing.ErrReferenceNotFound {
+			return nil, fmt.Errorf("failed to resolve revision %q: %w", rev, err)
+		}
+	}
+	return nil, fmt.Errorf("failed to resolve revision %q: %w", rev, plumbing.ErrReferenceNotFound)
 }
 
 // ReadDir implements filesys.FileSystem.
-func (g gitFS) ReadDir(path string) ([]string, error) {
-	return nil, errNotSupported("Walk")
+//
+// The names of the entries in the directory are returned in lexical order.
+func (g *gitFS) ReadDir(name string) ([]string, error) {
+	return g.readDir("readdir", name)
 }
 
 // IsDir implements filesys.FileSystem.
-func (g gitFS) IsDir(name string) bool {
-	// If it exists as a file, it's not a directory.
-	_, err := g.tree.File(name)
-	if err == nil {
-		return false
-	}
-	// Git doesn't store directories.
-	//
-	// If we can find a file with a prefix of the name we're looking for, then
-	// the name is a directory.
-	//
-	// TODO: make this a bit more efficent, cache found dirs?
-	isDir := false
-	err = g.tree.Files().ForEach(func(f *object.File) error {
-		if strings.HasPrefix(f.Name, name) {
-			isDir = true
-			return storer.ErrStop
-		}
-		return nil
-	})
-	// TODO: not a lot of choice here, there's no scope for returning an error.
-	if err != nil {
-		panic(err)
-	}
-	return isDir
+//
+// Git doesn't store directories, a path is a directory if there are files
+// stored beneath it.
+func (g *gitFS) IsDir(name string) bool {
+	_, ok := g.index[cleanPath(name)]
+	return ok
 }
 
 // CleanedAbs implements filesys.FileSystem.
-func (g gitFS) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
+func (g *gitFS) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
 	if g.IsDir(p) {
 		return filesys.ConfirmedDir(p), "", nil
 	}
@@ -90,8 +196,8 @@ func (g gitFS) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
 }
 
 // ReadFile implements filesys.FileSystem.
-func (g gitFS) ReadFile(name string) ([]byte, error) {
-	f, err := g.tree.File(name)
+func (g *gitFS) ReadFile(name string) ([]byte, error) {
+	f, err := g.file(cleanPath(name))
 	if err != nil {
 		return nil, err
 	}
@@ -103,50 +209,151 @@ func (g gitFS) ReadFile(name string) ([]byte, error) {
 }
 
 // Walk implements filesys.FileSystem.
-func (g gitFS) Walk(path string, walkFn filepath.WalkFunc) error {
-	return errNotSupported("Walk")
+//
+// The tree is walked in lexical order, in the same way as filepath.Walk.
+func (g *gitFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	return walk(g, root, walkFn)
 }
 
 // Create implements filesys.FileSystem.
-func (g gitFS) Create(name string) (filesys.File, error) {
+func (g *gitFS) Create(name string) (filesys.File, error) {
 	return nil, errNotSupported("Create")
 }
 
 // MkDir implements filesys.FileSystem.
-func (g gitFS) Mkdir(name string) error {
+func (g *gitFS) Mkdir(name string) error {
 	return errNotSupported("MkDir")
 }
 
 // MkDirAll implements filesys.FileSystem.
-func (g gitFS) MkdirAll(name string) error {
+func (g *gitFS) MkdirAll(name string) error {
 	return errNotSupported("MkdirAll")
 }
 
 // RemoveAll implements filesys.FileSystem.
-func (g gitFS) RemoveAll(name string) error {
+func (g *gitFS) RemoveAll(name string) error {
 	return errNotSupported("RemoveAll")
 }
 
 // Open implements filesys.FileSystem.
-func (g gitFS) Open(name string) (filesys.File, error) {
-	return nil, errNotSupported("Open")
+//
+// The returned file is read-only, directories can be opened, but not read
+// from.
+func (g *gitFS) Open(name string) (filesys.File, error) {
+	info, err := g.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &file{name: name, info: info}, nil
+	}
+	b, err := g.ReadFile(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{name: name, info: info, r: bytes.NewReader(b)}, nil
 }
 
 // Exists implements filesys.FileSystem.
-func (g gitFS) Exists(name string) bool {
-	return false
+func (g *gitFS) Exists(name string) bool {
+	_, err := g.stat("stat", name)
+	return err == nil
 }
 
 // Glob implements filesys.FileSystem.
-func (g gitFS) Glob(pattern string) ([]string, error) {
-	return nil, errNotSupported("Glob")
+//
+// This follows the same rules as filepath.Glob, the only possible returned
+// error is path.ErrBadPattern.
+func (g *gitFS) Glob(pattern string) ([]string, error) {
+	return glob(g, pattern)
 }
 
 // WriteFile implements filesys.FileSystem.
-func (g gitFS) WriteFile(name string, data []byte) error {
+func (g *gitFS) WriteFile(name string, data []byte) error {
 	return errNotSupported("WriteFile")
 }
 
+// readDir returns the sorted names of the entries in the named directory, the
+// error is reported as a *fs.PathError for the provided op.
+func (g *gitFS) readDir(op, name string) ([]string, error) {
+	entries, ok := g.index[cleanPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	names := make([]string, 0, len(entries))
+	for k := range entries {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stat returns the details of the named entry in the tree, the error is
+// reported as a *fs.PathError for the provided op.
+func (g *gitFS) stat(op, name string) (os.FileInfo, error) {
+	p := cleanPath(name)
+	if _, ok := g.index[p]; ok {
+		return &fileInfo{name: path.Base("/" + p), mode: os.ModeDir | 0755}, nil
+	}
+	dir, base := path.Split(p)
+	if isDir, ok := g.index[strings.TrimSuffix(dir, "/")][base]; !ok || isDir {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := g.file(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return &fileInfo{name: base, size: f.Size, mode: mode}, nil
+}
+
+func (g *gitFS) file(p string) (*object.File, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tree.File(p)
+}
+
+// dirIndex maps the path of each directory in a tree to the names of the
+// entries within it, the value for each entry is true if it's a directory.
+//
+// The root of the tree is "".
+type dirIndex map[string]map[string]bool
+
+func buildDirIndex(t *object.Tree) (dirIndex, error) {
+	idx := dirIndex{"": map[string]bool{}}
+	err := t.Files().ForEach(func(f *object.File) error {
+		isDir := false
+		for p := f.Name; p != ""; {
+			dir, base := path.Split(p)
+			dir = strings.TrimSuffix(dir, "/")
+			entries, ok := idx[dir]
+			if !ok {
+				entries = map[string]bool{}
+				idx[dir] = entries
+			}
+			if _, seen := entries[base]; seen {
+				break
+			}
+			entries[base] = isDir
+			p, isDir = dir, true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index the tree: %w", err)
+	}
+	return idx, nil
+}
+
+// cleanPath converts a path to the form used by Git trees, which has no
+// leading "/", and the root is "".
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
 func errNotSupported(s string) error {
 	return notSupported(s)
 }
@@ -156,3 +363,49 @@ type notSupported string
 func (f notSupported) Error() string {
 	return fmt.Sprintf("feature %#v not supported", string(f))
 }
+
+// file is a read-only implementation of filesys.File.
+type file struct {
+	name string
+	info os.FileInfo
+	r    *bytes.Reader
+}
+
+// Read implements io.Reader.
+func (f *file) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.r.Read(p)
+}
+
+// Write implements io.Writer.
+func (f *file) Write(p []byte) (int, error) {
+	return 0, errNotSupported("Write")
+}
+
+// Close implements io.Closer.
+func (f *file) Close() error {
+	return nil
+}
+
+// Stat returns the details of the file.
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// fileInfo implements os.FileInfo for entries in a Git tree.
+//
+// Git doesn't record modification times, so ModTime is always the zero time.
+type fileInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
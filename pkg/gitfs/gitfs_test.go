@@ -1,15 +1,28 @@
 package gitfs
 
 import (
+	"errors"
+	"io/fs"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/google/go-cmp/cmp"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
-var _ filesys.FileSystem = gitFS{}
+var _ filesys.FileSystem = &gitFS{}
+var _ filesys.File = &file{}
 
 func TestUnsupportedFeatures(t *testing.T) {
 	gfs := gitFS{}
@@ -19,15 +32,8 @@ func TestUnsupportedFeatures(t *testing.T) {
 	assertIsUnsupported(t, gfs.Mkdir("testing"))
 	assertIsUnsupported(t, gfs.MkdirAll("testing/testing"))
 	assertIsUnsupported(t, gfs.RemoveAll("testing/testing"))
-	_, err = gfs.Open("testing/file")
-	assertIsUnsupported(t, err)
-	_, err = gfs.Glob("test*")
-	assertIsUnsupported(t, err)
 	err = gfs.WriteFile("testing", []byte("testing"))
 	assertIsUnsupported(t, err)
-
-	_, err = gfs.ReadDir("")
-	assertIsUnsupported(t, err)
 }
 
 func TestReadFile(t *testing.T) {
@@ -56,6 +62,288 @@ func TestIsDir(t *testing.T) {
 	}
 }
 
+func TestReadDir(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	readDirTests := []struct {
+		name string
+		want []string
+	}{
+		{"", []string{"base", "base-old", "overlays", "top.yaml"}},
+		{".", []string{"base", "base-old", "overlays", "top.yaml"}},
+		{"/", []string{"base", "base-old", "overlays", "top.yaml"}},
+		{"base", []string{"deployment.yaml", "kustomization.yaml"}},
+		{"overlays/dev/", []string{"kustomization.yaml"}},
+		{"overlays/../base", []string{"deployment.yaml", "kustomization.yaml"}},
+	}
+
+	for _, tt := range readDirTests {
+		got, err := gfs.ReadDir(tt.name)
+		assertNoError(t, err)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ReadDir(%q) failed:\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestReadDirErrors(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	for _, name := range []string{"unknown", "top.yaml", "base/deployment.yaml"} {
+		_, err := gfs.ReadDir(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadDir(%q) got %v, want fs.ErrNotExist", name, err)
+		}
+	}
+}
+
+func TestExists(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	existsTests := []struct {
+		name string
+		want bool
+	}{
+		{"", true},
+		{"top.yaml", true},
+		{"base", true},
+		{"base/", true},
+		{"base/deployment.yaml", true},
+		{"overlays/dev/kustomization.yaml", true},
+		{"bas", false},
+		{"base/unknown.yaml", false},
+		{"top.yaml/unknown", false},
+	}
+
+	for _, tt := range existsTests {
+		if got := gfs.Exists(tt.name); got != tt.want {
+			t.Errorf("Exists(%q) got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	f, err := gfs.Open("base/deployment.yaml")
+	assertNoError(t, err)
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: Deployment\n", string(b)); diff != "" {
+		t.Fatalf("failed to read file:\n%s", diff)
+	}
+	info, err := f.Stat()
+	assertNoError(t, err)
+	if info.Name() != "deployment.yaml" || info.Size() != 17 || info.IsDir() {
+		t.Fatalf("incorrect file info: %s %d %v", info.Name(), info.Size(), info.IsDir())
+	}
+	_, err = f.Write([]byte("testing"))
+	assertIsUnsupported(t, err)
+}
+
+func TestOpenDirectory(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	f, err := gfs.Open("overlays")
+	assertNoError(t, err)
+
+	info, err := f.Stat()
+	assertNoError(t, err)
+	if !info.IsDir() {
+		t.Fatal("Stat() for a directory returned a file")
+	}
+	if _, err := f.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected an error reading a directory")
+	}
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	_, err := gfs.Open("base/unknown.yaml")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	globTests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.yaml", []string{"top.yaml"}},
+		{"base/*.yaml", []string{"base/deployment.yaml", "base/kustomization.yaml"}},
+		{"base*", []string{"base", "base-old"}},
+		{"*/kustomization.yaml", []string{"base/kustomization.yaml", "base-old/kustomization.yaml"}},
+		{"overlays/*/kustomization.yaml", []string{"overlays/dev/kustomization.yaml", "overlays/staging/kustomization.yaml"}},
+		{"base/deployment.yaml", []string{"base/deployment.yaml"}},
+		{"base/unknown.yaml", nil},
+		{"unknown/*", nil},
+	}
+
+	for _, tt := range globTests {
+		got, err := gfs.Glob(tt.pattern)
+		assertNoError(t, err)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Glob(%q) failed:\n%s", tt.pattern, diff)
+		}
+	}
+}
+
+func TestGlobWithBadPattern(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	_, err := gfs.Glob("base/[")
+	if err == nil {
+		t.Fatal("expected an error with a bad pattern")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	walked := []string{}
+	err := gfs.Walk("overlays", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			path = path + "/"
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	assertNoError(t, err)
+
+	want := []string{
+		"overlays/",
+		"overlays/dev/",
+		"overlays/dev/kustomization.yaml",
+		"overlays/staging/",
+		"overlays/staging/kustomization.yaml",
+	}
+	if diff := cmp.Diff(want, walked); diff != "" {
+		t.Fatalf("walk failed:\n%s", diff)
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	walked := []string{}
+	err := gfs.Walk("", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != "" {
+			return filepath.SkipDir
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	assertNoError(t, err)
+
+	want := []string{"", "top.yaml"}
+	if diff := cmp.Diff(want, walked); diff != "" {
+		t.Fatalf("walk failed:\n%s", diff)
+	}
+}
+
+func TestWalkMissingPath(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	err := gfs.Walk("unknown", func(path string, info os.FileInfo, err error) error {
+		return err
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestIsDirMatchesWholePathSegments(t *testing.T) {
+	gfs := newTestFS(t, makeTreeFromFiles(t, map[string]string{
+		"base-old/kustomization.yaml": "resources: []\n",
+		"overlays/dev.yaml":           "kind: Dev\n",
+	}))
+
+	isDirTests := []struct {
+		name string
+		want bool
+	}{
+		{"", true},
+		{"base", false},
+		{"base-old", true},
+		{"base-old/", true},
+		{"/base-old", true},
+		{"overlays/dev", false},
+		{"overlays/dev.yaml", false},
+		{"overlays", true},
+	}
+
+	for _, tt := range isDirTests {
+		if got := gfs.IsDir(tt.name); got != tt.want {
+			t.Errorf("IsDir(%q) got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDirIndex(t *testing.T) {
+	idx, err := buildDirIndex(makeTestTree(t))
+	assertNoError(t, err)
+
+	want := dirIndex{
+		"":                 {"top.yaml": false, "base": true, "base-old": true, "overlays": true},
+		"base":             {"deployment.yaml": false, "kustomization.yaml": false},
+		"base-old":         {"kustomization.yaml": false},
+		"overlays":         {"dev": true, "staging": true},
+		"overlays/dev":     {"kustomization.yaml": false},
+		"overlays/staging": {"kustomization.yaml": false},
+	}
+	if diff := cmp.Diff(want, idx); diff != "" {
+		t.Fatalf("index didn't match:\n%s", diff)
+	}
+}
+
+func TestNewWithMissingObjects(t *testing.T) {
+	s := memory.NewStorage()
+	tree := &object.Tree{Entries: []object.TreeEntry{
+		{Name: "kustomization.yaml", Mode: filemode.Regular, Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+	}}
+	obj := s.NewEncodedObject()
+	assertNoError(t, tree.Encode(obj))
+	h, err := s.SetEncodedObject(obj)
+	assertNoError(t, err)
+	tree, err = object.GetTree(s, h)
+	assertNoError(t, err)
+
+	if _, err := New(tree); !errors.Is(err, plumbing.ErrObjectNotFound) {
+		t.Fatalf("got %v, want %v", err, plumbing.ErrObjectNotFound)
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	gfs := newTestFS(t, makeTestTree(t))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gfs.ReadFile("base/deployment.yaml"); err != nil {
+				t.Error(err)
+			}
+			if !gfs.Exists("overlays/dev/kustomization.yaml") {
+				t.Error("file does not exist")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestCleanedAbs(t *testing.T) {
 	gfs := makeClonedGFS(t)
 
@@ -105,6 +393,122 @@ func TestNewInMemoryFromOptions(t *testing.T) {
 	}
 }
 
+// newTestFS creates a filesystem from a tree, failing the test if the tree
+// can't be read.
+func newTestFS(t *testing.T, tree *object.Tree) filesys.FileSystem {
+	t.Helper()
+	gfs, err := New(tree)
+	assertNoError(t, err)
+	return gfs
+}
+
+// makeTestTree creates an in-memory Git repository with a small set of files
+// and returns the tree from the commit.
+func makeTestTree(t *testing.T) *object.Tree {
+	t.Helper()
+	return makeTreeFromFiles(t, map[string]string{
+		"top.yaml":                            "kind: Top\n",
+		"base/kustomization.yaml":             "resources:\n- deployment.yaml\n",
+		"base/deployment.yaml":                "kind: Deployment\n",
+		"base-old/kustomization.yaml":         "resources: []\n",
+		"overlays/dev/kustomization.yaml":     "resources:\n- ../../base\n",
+		"overlays/staging/kustomization.yaml": "resources:\n- ../../base\n",
+	})
+}
+
+func makeTreeFromFiles(t *testing.T, files map[string]string) *object.Tree {
+	t.Helper()
+	r, err := git.Init(memory.NewStorage(), memfs.New())
+	assertNoError(t, err)
+	wt, err := r.Worktree()
+	assertNoError(t, err)
+	for name, body := range files {
+		assertNoError(t, util.WriteFile(wt.Filesystem, name, []byte(body), 0644))
+		_, err := wt.Add(name)
+		assertNoError(t, err)
+	}
+	h, err := wt.Commit("testing", &git.CommitOptions{
+		Author: &object.Signature{Name: "Testing", Email: "testing@example.com", When: time.Now()},
+	})
+	assertNoError(t, err)
+	commit, err := r.CommitObject(h)
+	assertNoError(t, err)
+	tree, err := commit.Tree()
+	assertNoError(t, err)
+	return tree
+}
+
+func TestNewInMemoryAtRevision(t *testing.T) {
+	dir, first, second := makeTestRepository(t)
+
+	revisionTests := []struct {
+		rev  string
+		want string
+	}{
+		{"", "version: 2\n"},
+		{"master", "version: 2\n"},
+		{"release-1.4", "version: 1\n"},
+		{"v1.4.0", "version: 1\n"},
+		{"v1.4.1", "version: 1\n"},
+		{first.String(), "version: 1\n"},
+		{first.String()[:7], "version: 1\n"},
+		{second.String(), "version: 2\n"},
+	}
+
+	for _, tt := range revisionTests {
+		t.Run(tt.rev, func(t *testing.T) {
+			gfs, err := NewInMemoryAtRevision(&git.CloneOptions{URL: dir}, tt.rev)
+			assertNoError(t, err)
+
+			b, err := gfs.ReadFile("config.yaml")
+			assertNoError(t, err)
+			if diff := cmp.Diff(tt.want, string(b)); diff != "" {
+				t.Fatalf("incorrect file at revision %q:\n%s", tt.rev, diff)
+			}
+		})
+	}
+}
+
+func TestNewInMemoryAtRevisionWithUnknownRevision(t *testing.T) {
+	dir, _, _ := makeTestRepository(t)
+
+	_, err := NewInMemoryAtRevision(&git.CloneOptions{URL: dir}, "unknown")
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		t.Fatalf("got %v, want plumbing.ErrReferenceNotFound", err)
+	}
+}
+
+// makeTestRepository creates a repository on disk with two commits, the
+// first commit is the "release-1.4" branch, and is tagged with a lightweight
+// "v1.4.0" tag and an annotated "v1.4.1" tag.
+func makeTestRepository(t *testing.T) (string, plumbing.Hash, plumbing.Hash) {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	assertNoError(t, err)
+	wt, err := r.Worktree()
+	assertNoError(t, err)
+	sig := &object.Signature{Name: "Testing", Email: "testing@example.com", When: time.Now()}
+
+	commitFile := func(body string) plumbing.Hash {
+		assertNoError(t, util.WriteFile(wt.Filesystem, "config.yaml", []byte(body), 0644))
+		_, err := wt.Add("config.yaml")
+		assertNoError(t, err)
+		h, err := wt.Commit("testing", &git.CommitOptions{Author: sig})
+		assertNoError(t, err)
+		return h
+	}
+
+	first := commitFile("version: 1\n")
+	assertNoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release-1.4"), first)))
+	_, err = r.CreateTag("v1.4.0", first, nil)
+	assertNoError(t, err)
+	_, err = r.CreateTag("v1.4.1", first, &git.CreateTagOptions{Tagger: sig, Message: "v1.4.1"})
+	assertNoError(t, err)
+	second := commitFile("version: 2\n")
+	return dir, first, second
+}
+
 func makeClonedGFS(t *testing.T) filesys.FileSystem {
 	t.Helper()
 	gfs, err := NewInMemoryFromOptions(
@@ -0,0 +1,397 @@
+package gitfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var (
+	errIsDir     = errors.New("is a directory")
+	errNotDir    = errors.New("not a directory")
+	errWriteOnly = errors.New("file is write-only")
+)
+
+// Change is a file that differs between an Overlay and the filesystem it was
+// created from.
+type Change struct {
+	Path     string
+	Contents []byte
+	Removed  bool
+}
+
+// Overlay is a copy-on-write filesys.FileSystem, reads are passed through to
+// a read-only base filesystem, and writes are recorded in memory.
+//
+// The base is typically a filesystem returned from New, which allows files
+// in a Git tree to be modified and rebuilt with Kustomize before the changes
+// are committed.
+//
+// Overlays are not safe for concurrent modification.
+type Overlay struct {
+	base    filesys.FileSystem
+	files   map[string][]byte
+	dirs    map[string]bool
+	removed map[string]bool
+}
+
+// NewOverlay creates and returns a new Overlay on top of a base filesystem.
+func NewOverlay(base filesys.FileSystem) *Overlay {
+	return &Overlay{
+		base:    base,
+		files:   map[string][]byte{},
+		dirs:    map[string]bool{},
+		removed: map[string]bool{},
+	}
+}
+
+// Changes returns the files that have been written or removed, in path order.
+//
+// Files that have been written with the same contents as the base are not
+// reported as changed.
+func (o *Overlay) Changes() ([]Change, error) {
+	changes := []Change{}
+	for p, data := range o.files {
+		if !o.base.IsDir(p) && o.base.Exists(p) {
+			existing, err := o.base.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(existing, data) {
+				continue
+			}
+		}
+		changes = append(changes, Change{Path: p, Contents: copyBytes(data)})
+	}
+
+	removed := map[string]bool{}
+	for p := range o.removed {
+		if !o.base.Exists(p) {
+			continue
+		}
+		err := o.base.Walk(p, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name = cleanPath(name)
+			if _, ok := o.files[name]; !info.IsDir() && !ok {
+				removed[name] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for p := range removed {
+		changes = append(changes, Change{Path: p, Removed: true})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// Create implements filesys.FileSystem.
+//
+// The returned file can be written to, but not read from.
+func (o *Overlay) Create(name string) (filesys.File, error) {
+	if err := o.WriteFile(name, []byte{}); err != nil {
+		return nil, err
+	}
+	return &overlayFile{overlay: o, name: name, path: cleanPath(name)}, nil
+}
+
+// Mkdir implements filesys.FileSystem.
+func (o *Overlay) Mkdir(name string) error {
+	p := cleanPath(name)
+	if _, err := o.stat("mkdir", name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if !o.isDir(parentPath(p)) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	}
+	o.dirs[p] = true
+	return nil
+}
+
+// MkdirAll implements filesys.FileSystem.
+func (o *Overlay) MkdirAll(name string) error {
+	p := cleanPath(name)
+	if p == "" {
+		return nil
+	}
+	segments := strings.Split(p, "/")
+	for i := range segments {
+		dir := strings.Join(segments[:i+1], "/")
+		if o.isDir(dir) {
+			continue
+		}
+		if o.isFile(dir) {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errNotDir}
+		}
+		o.dirs[dir] = true
+	}
+	return nil
+}
+
+// RemoveAll implements filesys.FileSystem.
+func (o *Overlay) RemoveAll(name string) error {
+	p := cleanPath(name)
+	for k := range o.files {
+		if isWithin(k, p) {
+			delete(o.files, k)
+		}
+	}
+	for k := range o.dirs {
+		if isWithin(k, p) {
+			delete(o.dirs, k)
+		}
+	}
+	o.removed[p] = true
+	return nil
+}
+
+// Open implements filesys.FileSystem.
+func (o *Overlay) Open(name string) (filesys.File, error) {
+	p := cleanPath(name)
+	if data, ok := o.files[p]; ok {
+		info := &fileInfo{name: path.Base("/" + p), size: int64(len(data)), mode: 0644}
+		return &file{name: name, info: info, r: bytes.NewReader(copyBytes(data))}, nil
+	}
+	if o.isDir(p) {
+		return &file{name: name, info: &fileInfo{name: path.Base("/" + p), mode: os.ModeDir | 0755}}, nil
+	}
+	if o.hidden(p) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.Open(p)
+}
+
+// IsDir implements filesys.FileSystem.
+func (o *Overlay) IsDir(name string) bool {
+	return o.isDir(cleanPath(name))
+}
+
+// ReadDir implements filesys.FileSystem.
+//
+// The names of the entries in the directory are returned in lexical order.
+func (o *Overlay) ReadDir(name string) ([]string, error) {
+	return o.readDir("readdir", name)
+}
+
+// CleanedAbs implements filesys.FileSystem.
+func (o *Overlay) CleanedAbs(p string) (filesys.ConfirmedDir, string, error) {
+	if o.IsDir(p) {
+		return filesys.ConfirmedDir(p), "", nil
+	}
+	d := path.Dir(p)
+	f := path.Base(p)
+	return filesys.ConfirmedDir(d), f, nil
+}
+
+// Exists implements filesys.FileSystem.
+func (o *Overlay) Exists(name string) bool {
+	_, err := o.stat("stat", name)
+	return err == nil
+}
+
+// Glob implements filesys.FileSystem.
+func (o *Overlay) Glob(pattern string) ([]string, error) {
+	return glob(o, pattern)
+}
+
+// ReadFile implements filesys.FileSystem.
+func (o *Overlay) ReadFile(name string) ([]byte, error) {
+	p := cleanPath(name)
+	if data, ok := o.files[p]; ok {
+		return copyBytes(data), nil
+	}
+	if o.isDir(p) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	if o.hidden(p) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.ReadFile(p)
+}
+
+// WriteFile implements filesys.FileSystem.
+//
+// Git doesn't store directories, so any missing parent directories are
+// created.
+func (o *Overlay) WriteFile(name string, data []byte) error {
+	p := cleanPath(name)
+	if o.isDir(p) {
+		return &fs.PathError{Op: "write", Path: name, Err: errIsDir}
+	}
+	for dir := parentPath(p); dir != ""; dir = parentPath(dir) {
+		if o.isFile(dir) {
+			return &fs.PathError{Op: "write", Path: name, Err: errNotDir}
+		}
+	}
+	o.files[p] = copyBytes(data)
+	return nil
+}
+
+// Walk implements filesys.FileSystem.
+func (o *Overlay) Walk(root string, walkFn filepath.WalkFunc) error {
+	return walk(o, root, walkFn)
+}
+
+func (o *Overlay) readDir(op, name string) ([]string, error) {
+	p := cleanPath(name)
+	if !o.isDir(p) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	entries := map[string]bool{}
+	if !o.hidden(p) && o.base.IsDir(p) {
+		names, err := o.base.ReadDir(p)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		for _, n := range names {
+			if !o.removed[path.Join(p, n)] {
+				entries[n] = true
+			}
+		}
+	}
+	addChild := func(k string) {
+		if k == p || !isWithin(k, p) {
+			return
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(k, p), "/")
+		entries[strings.SplitN(rel, "/", 2)[0]] = true
+	}
+	for k := range o.files {
+		addChild(k)
+	}
+	for k := range o.dirs {
+		addChild(k)
+	}
+
+	names := make([]string, 0, len(entries))
+	for k := range entries {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (o *Overlay) stat(op, name string) (os.FileInfo, error) {
+	p := cleanPath(name)
+	if data, ok := o.files[p]; ok {
+		return &fileInfo{name: path.Base("/" + p), size: int64(len(data)), mode: 0644}, nil
+	}
+	if o.isDir(p) {
+		return &fileInfo{name: path.Base("/" + p), mode: os.ModeDir | 0755}, nil
+	}
+	if o.hidden(p) || !o.base.Exists(p) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := o.base.Open(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// isDir returns true if the cleaned path is a directory in the overlay.
+func (o *Overlay) isDir(p string) bool {
+	if p == "" || o.dirs[p] {
+		return true
+	}
+	if _, ok := o.files[p]; ok {
+		return false
+	}
+	for k := range o.files {
+		if isWithin(k, p) {
+			return true
+		}
+	}
+	for k := range o.dirs {
+		if isWithin(k, p) {
+			return true
+		}
+	}
+	return !o.hidden(p) && o.base.IsDir(p)
+}
+
+// isFile returns true if the cleaned path is a file in the overlay.
+func (o *Overlay) isFile(p string) bool {
+	info, err := o.stat("stat", p)
+	return err == nil && !info.IsDir()
+}
+
+// hidden returns true if the cleaned path, or one of its parents, has been
+// removed from the base filesystem.
+func (o *Overlay) hidden(p string) bool {
+	for {
+		if o.removed[p] {
+			return true
+		}
+		if p == "" {
+			return false
+		}
+		p = parentPath(p)
+	}
+}
+
+// overlayFile is a write-only file returned from Overlay.Create.
+type overlayFile struct {
+	overlay *Overlay
+	name    string
+	path    string
+}
+
+// Read implements io.Reader.
+func (f *overlayFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errWriteOnly}
+}
+
+// Write implements io.Writer.
+func (f *overlayFile) Write(p []byte) (int, error) {
+	data, ok := f.overlay.files[f.path]
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.overlay.files[f.path] = append(data, p...)
+	return len(p), nil
+}
+
+// Close implements io.Closer.
+func (f *overlayFile) Close() error {
+	return nil
+}
+
+// Stat returns the details of the file.
+func (f *overlayFile) Stat() (os.FileInfo, error) {
+	return f.overlay.stat("stat", f.name)
+}
+
+// isWithin returns true if the cleaned path p is dir, or is beneath dir.
+func isWithin(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// parentPath returns the parent of a cleaned path, the parent of top-level
+// entries is "".
+func parentPath(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -0,0 +1,219 @@
+package gitfs
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+var _ filesys.FileSystem = &Overlay{}
+
+func TestOverlayReadsFromBase(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+
+	b, err := o.ReadFile("base/deployment.yaml")
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: Deployment\n", string(b)); diff != "" {
+		t.Fatalf("failed to read file:\n%s", diff)
+	}
+
+	names, err := o.ReadDir("")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"base", "base-old", "overlays", "top.yaml"}, names); diff != "" {
+		t.Fatalf("failed to read dir:\n%s", diff)
+	}
+}
+
+func TestOverlayWriteFile(t *testing.T) {
+	base := newTestFS(t, makeTestTree(t))
+	o := NewOverlay(base)
+
+	assertNoError(t, o.WriteFile("base/deployment.yaml", []byte("kind: StatefulSet\n")))
+	assertNoError(t, o.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+
+	b, err := o.ReadFile("base/deployment.yaml")
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: StatefulSet\n", string(b)); diff != "" {
+		t.Fatalf("failed to read file:\n%s", diff)
+	}
+	if !o.IsDir("overlays/prod") {
+		t.Fatal("parent directory of a new file was not created")
+	}
+	names, err := o.ReadDir("overlays")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"dev", "prod", "staging"}, names); diff != "" {
+		t.Fatalf("failed to read dir:\n%s", diff)
+	}
+
+	b, err = base.ReadFile("base/deployment.yaml")
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: Deployment\n", string(b)); diff != "" {
+		t.Fatalf("base was modified:\n%s", diff)
+	}
+	if base.Exists("overlays/prod/kustomization.yaml") {
+		t.Fatal("new file was written to the base")
+	}
+}
+
+func TestOverlayWriteFileErrors(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+
+	if err := o.WriteFile("base", []byte("test")); err == nil {
+		t.Fatal("expected an error writing to a directory")
+	}
+	if err := o.WriteFile("top.yaml/test.yaml", []byte("test")); err == nil {
+		t.Fatal("expected an error writing beneath a file")
+	}
+}
+
+func TestOverlayCreate(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+
+	f, err := o.Create("base/service.yaml")
+	assertNoError(t, err)
+	_, err = f.Write([]byte("kind: "))
+	assertNoError(t, err)
+	_, err = f.Write([]byte("Service\n"))
+	assertNoError(t, err)
+	assertNoError(t, f.Close())
+
+	info, err := f.Stat()
+	assertNoError(t, err)
+	if info.Name() != "service.yaml" || info.Size() != 14 {
+		t.Fatalf("incorrect file info: %s %d", info.Name(), info.Size())
+	}
+
+	r, err := o.Open("base/service.yaml")
+	assertNoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assertNoError(t, err)
+	if diff := cmp.Diff("kind: Service\n", string(b)); diff != "" {
+		t.Fatalf("failed to read file:\n%s", diff)
+	}
+}
+
+func TestOverlayRemoveAll(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+	assertNoError(t, o.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+
+	assertNoError(t, o.RemoveAll("overlays"))
+
+	for _, name := range []string{"overlays", "overlays/dev/kustomization.yaml", "overlays/prod/kustomization.yaml"} {
+		if o.Exists(name) {
+			t.Errorf("%q exists after removal", name)
+		}
+	}
+	_, err := o.ReadFile("overlays/dev/kustomization.yaml")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+	names, err := o.ReadDir("")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"base", "base-old", "top.yaml"}, names); diff != "" {
+		t.Fatalf("failed to read dir:\n%s", diff)
+	}
+}
+
+func TestOverlayRecreateRemovedDirectory(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+	assertNoError(t, o.RemoveAll("base"))
+
+	assertNoError(t, o.WriteFile("base/kustomization.yaml", []byte("resources: []\n")))
+
+	names, err := o.ReadDir("base")
+	assertNoError(t, err)
+	if diff := cmp.Diff([]string{"kustomization.yaml"}, names); diff != "" {
+		t.Fatalf("failed to read dir:\n%s", diff)
+	}
+}
+
+func TestOverlayMkdir(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+
+	assertNoError(t, o.Mkdir("overlays/prod"))
+	if !o.IsDir("overlays/prod") {
+		t.Fatal("Mkdir() didn't create the directory")
+	}
+	if err := o.Mkdir("base"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("got %v, want fs.ErrExist", err)
+	}
+	if err := o.Mkdir("unknown/dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want fs.ErrNotExist", err)
+	}
+
+	assertNoError(t, o.MkdirAll("unknown/dir"))
+	if !o.IsDir("unknown") || !o.IsDir("unknown/dir") {
+		t.Fatal("MkdirAll() didn't create the directories")
+	}
+	if err := o.MkdirAll("top.yaml/dir"); err == nil {
+		t.Fatal("expected an error creating a directory beneath a file")
+	}
+}
+
+func TestOverlayWalk(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+	assertNoError(t, o.RemoveAll("overlays/staging"))
+	assertNoError(t, o.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+
+	walked := []string{}
+	err := o.Walk("overlays", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	assertNoError(t, err)
+
+	want := []string{
+		"overlays",
+		"overlays/dev",
+		"overlays/dev/kustomization.yaml",
+		"overlays/prod",
+		"overlays/prod/kustomization.yaml",
+	}
+	if diff := cmp.Diff(want, walked); diff != "" {
+		t.Fatalf("walk failed:\n%s", diff)
+	}
+}
+
+func TestOverlayGlob(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+	assertNoError(t, o.RemoveAll("overlays/staging"))
+	assertNoError(t, o.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+
+	got, err := o.Glob("overlays/*/kustomization.yaml")
+	assertNoError(t, err)
+
+	want := []string{"overlays/dev/kustomization.yaml", "overlays/prod/kustomization.yaml"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("glob failed:\n%s", diff)
+	}
+}
+
+func TestOverlayChanges(t *testing.T) {
+	o := NewOverlay(newTestFS(t, makeTestTree(t)))
+	assertNoError(t, o.WriteFile("base/deployment.yaml", []byte("kind: StatefulSet\n")))
+	assertNoError(t, o.WriteFile("top.yaml", []byte("kind: Top\n")))
+	assertNoError(t, o.WriteFile("overlays/prod/kustomization.yaml", []byte("resources: []\n")))
+	assertNoError(t, o.RemoveAll("overlays/staging"))
+	assertNoError(t, o.RemoveAll("base-old"))
+	assertNoError(t, o.WriteFile("base-old/kustomization.yaml", []byte("resources: []\n")))
+
+	changes, err := o.Changes()
+	assertNoError(t, err)
+
+	want := []Change{
+		{Path: "base/deployment.yaml", Contents: []byte("kind: StatefulSet\n")},
+		{Path: "overlays/prod/kustomization.yaml", Contents: []byte("resources: []\n")},
+		{Path: "overlays/staging/kustomization.yaml", Removed: true},
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Fatalf("changes didn't match:\n%s", diff)
+	}
+}
@@ -0,0 +1,125 @@
+package gitfs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dirReader is implemented by the filesystems in this package, and provides
+// the primitives that Walk and Glob are implemented on top of.
+type dirReader interface {
+	// readDir returns the sorted names of the entries in the named directory,
+	// the error is reported as a *fs.PathError for the provided op.
+	readDir(op, name string) ([]string, error)
+
+	// stat returns the details of the named entry, the error is reported as a
+	// *fs.PathError for the provided op.
+	stat(op, name string) (os.FileInfo, error)
+}
+
+// walk emulates filepath.Walk over a dirReader.
+func walk(d dirReader, root string, walkFn filepath.WalkFunc) error {
+	info, err := d.stat("lstat", root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = walkDir(d, root, info, walkFn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(d dirReader, name string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(name, info, nil)
+	}
+	names, err := d.readDir("readdir", name)
+	err1 := walkFn(name, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, entry := range names {
+		filename := path.Join(name, entry)
+		fileInfo, err := d.stat("lstat", filename)
+		if err != nil {
+			if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		err = walkDir(d, filename, fileInfo, walkFn)
+		if err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// glob emulates filepath.Glob over a dirReader.
+func glob(d dirReader, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(pattern) {
+		if _, err := d.stat("lstat", pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = cleanGlobPath(dir)
+	if !hasMeta(dir) {
+		return globDir(d, dir, file, nil), nil
+	}
+	// Prevent infinite recursion.
+	if dir == pattern {
+		return nil, path.ErrBadPattern
+	}
+
+	dirs, err := glob(d, dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, dir := range dirs {
+		matches = globDir(d, dir, file, matches)
+	}
+	return matches, nil
+}
+
+// globDir appends the entries in dir that match pattern to matches, the
+// pattern must have been validated already.
+func globDir(d dirReader, dir, pattern string, matches []string) []string {
+	names, err := d.readDir("open", dir)
+	if err != nil {
+		return matches
+	}
+	for _, n := range names {
+		if matched, _ := path.Match(pattern, n); matched {
+			matches = append(matches, path.Join(dir, n))
+		}
+	}
+	return matches
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
+
+func cleanGlobPath(p string) string {
+	switch p {
+	case "":
+		return "."
+	case "/":
+		return p
+	default:
+		return p[0 : len(p)-1]
+	}
+}
@@ -2,11 +2,20 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
-	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 
 	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/render"
+	"github.com/bigkevmcd/peanut/pkg/repository"
 )
 
 // TODO: Add logr.Logger
@@ -14,7 +23,12 @@ import (
 // APIRouter is an HTTP API for accessing app configurations.
 type APIRouter struct {
 	*http.ServeMux
-	cfg *config.Config
+	cfg   *config.Config
+	repos *repository.Manager
+
+	// Workers limits the number of Kustomize builds that run at the same
+	// time for a request, it defaults to config.DefaultWorkers.
+	Workers int
 }
 
 // ListApps returns the list of configured apps.
@@ -39,27 +53,122 @@ func (a *APIRouter) GetApp(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetAppConfig returns a specific app's desired state.
+//
+// The desired state is parsed from the app's configured revision, unless a
+// "ref" query parameter is provided with a branch, tag or commit.
 func (a *APIRouter) GetAppConfig(w http.ResponseWriter, r *http.Request) {
 	app := a.cfg.App(r.PathValue("name"))
+	if app == nil {
+		http.NotFound(w, r)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 
-	desired, err := config.ParseManifests(app)
+	rev := revision(app, r)
+	desired, err := a.parseApp(r, app, rev)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	response, err := createConfigResponse(app, desired[app.Name])
+	response := createConfigResponse(app, rev, desired.App(app.Name))
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode resource as JSON: %s", err)
+	}
+}
+
+// DiffEnvironments returns the differences between the services of an app in
+// the environments in the "from" and "to" query parameters.
+//
+// The app is parsed from its configured revision, unless a "ref" query
+// parameter is provided.
+func (a *APIRouter) DiffEnvironments(w http.ResponseWriter, r *http.Request) {
+	app := a.cfg.App(r.PathValue("name"))
+	if app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, name := range []string{from, to} {
+		if app.Environment(name) == nil {
+			http.Error(w, fmt.Sprintf("unknown environment %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	desired, err := a.parseApp(r, app, revision(app, r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	diff, err := config.DiffEnvironments(desired.App(app.Name), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		log.Printf("failed to encode resource as JSON: %s", err)
+	}
+}
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+// parseApp parses the desired state of an app at a revision.
+func (a *APIRouter) parseApp(r *http.Request, app *config.App, rev string) (*config.DesiredState, error) {
+	gfs, commit, err := a.repos.FileSystem(r.Context(), app.RepoURL, rev)
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseManifestsConcurrently(app, gfs, commit, a.Workers)
+}
+
+// revision returns the revision in the "ref" query parameter, or the app's
+// configured revision.
+func revision(app *config.App, r *http.Request) string {
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		return ref
+	}
+	return app.Revision
+}
+
+// ListDesiredStates returns the desired state of all the configured apps at
+// their configured revisions.
+//
+// The apps are parsed concurrently, and are returned in the order that they're
+// configured.
+func (a *APIRouter) ListDesiredStates(w http.ResponseWriter, r *http.Request) {
+	fsFor := func(app *config.App) (filesys.FileSystem, plumbing.Hash, error) {
+		return a.repos.FileSystem(r.Context(), app.RepoURL, app.Revision)
+	}
+	states, err := config.ParseAllManifests(a.cfg.Apps, fsFor, a.Workers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := listConfigsResponse{Apps: []*configResponse{}}
+	for i, app := range a.cfg.Apps {
+		result.Apps = append(result.Apps, createConfigResponse(app, app.Revision, states[i].App(app.Name)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
 		log.Printf("failed to encode resource as JSON: %s", err)
 	}
 }
 
+// RefreshApp fetches the latest changes to an app's repository.
+func (a *APIRouter) RefreshApp(w http.ResponseWriter, r *http.Request) {
+	app := a.cfg.App(r.PathValue("name"))
+	if app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := a.repos.Fetch(r.Context(), app.RepoURL); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // GetEnvironment returns a specific app.
 func (a *APIRouter) GetEnvironment(w http.ResponseWriter, r *http.Request) {
 	env := a.cfg.App(r.PathValue("name")).Environment(r.PathValue("env"))
@@ -69,13 +178,165 @@ func (a *APIRouter) GetEnvironment(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DiffRenderedEnvironment returns the differences between the resources
+// rendered for an environment at the "base" and "head" revisions.
+//
+// Either revision defaults to the app's configured revision.
+func (a *APIRouter) DiffRenderedEnvironment(w http.ResponseWriter, r *http.Request) {
+	app := a.cfg.App(r.PathValue("name"))
+	if app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	env := app.Environment(r.PathValue("env"))
+	if env == nil {
+		http.NotFound(w, r)
+		return
+	}
+	response := renderDiffResponse{
+		App:         app.Name,
+		Environment: env.Name,
+		Path:        env.Path(),
+		Base:        app.Revision,
+		Head:        app.Revision,
+	}
+	if v := r.URL.Query().Get("base"); v != "" {
+		response.Base = v
+	}
+	if v := r.URL.Query().Get("head"); v != "" {
+		response.Head = v
+	}
+	base, baseCommit, err := a.repos.FileSystem(r.Context(), app.RepoURL, response.Base)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	head, headCommit, err := a.repos.FileSystem(r.Context(), app.RepoURL, response.Head)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.BaseCommit, response.HeadCommit = commitString(baseCommit), commitString(headCommit)
+	response.Resources, err = render.DiffFileSystems(response.Path, base, head)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to encode resource as JSON: %s", err)
+	}
+}
+
+// GetManifests returns the resources rendered for an environment, as a
+// multi-document YAML stream, or as a JSON list if the request prefers
+// "application/json".
+//
+// The resources can be filtered with the "kind", "name" and "selector" query
+// parameters, and are rendered from the app's configured revision, unless a
+// "ref" query parameter is provided.
+func (a *APIRouter) GetManifests(w http.ResponseWriter, r *http.Request) {
+	app := a.cfg.App(r.PathValue("name"))
+	if app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	env := app.Environment(r.PathValue("env"))
+	if env == nil {
+		http.NotFound(w, r)
+		return
+	}
+	gfs, _, err := a.repos.FileSystem(r.Context(), app.RepoURL, revision(app, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	filter := render.Filter{Kind: q.Get("kind"), Name: q.Get("name"), Selector: q.Get("selector")}
+	resources, err := render.Manifests(env.Path(), gfs, filter)
+	if errors.Is(err, render.ErrInvalidSelector) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	write, contentType := render.WriteYAML, "application/yaml"
+	if negotiate(r.Header.Values("Accept"), contentType, "application/json") == "application/json" {
+		write, contentType = render.WriteJSON, "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err := write(w, resources); err != nil {
+		log.Printf("failed to write the manifests: %s", err)
+	}
+}
+
+// negotiate returns the offered media type with the highest quality in the
+// Accept headers, the quality of an offer comes from the most specific media
+// range that matches it, and ties go to the earliest offer.
+//
+// The first offer is returned if there are no Accept headers, or none of the
+// offers are acceptable.
+func negotiate(accept []string, offers ...string) string {
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, header := range accept {
+			for _, v := range strings.Split(header, ",") {
+				mediaType, params, err := mime.ParseMediaType(v)
+				if err != nil {
+					continue
+				}
+				s := matchMediaRange(mediaType, offer)
+				if s <= specificity {
+					continue
+				}
+				q, specificity = 1.0, s
+				if qv, ok := params["q"]; ok {
+					if q, err = strconv.ParseFloat(qv, 64); err != nil {
+						q = 0
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// matchMediaRange returns how specific a media range is if it matches a media
+// type, 2 for the type itself, 1 for "type/*" and 0 for "*/*", or -1 if it
+// doesn't match.
+func matchMediaRange(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
 // NewRouter creates and returns a new APIRouter.
-func NewRouter(cfg *config.Config) *APIRouter {
-	api := &APIRouter{ServeMux: http.NewServeMux(), cfg: cfg}
+//
+// The app repositories are read from the clones in the repository manager.
+func NewRouter(cfg *config.Config, repos *repository.Manager) *APIRouter {
+	api := &APIRouter{ServeMux: http.NewServeMux(), cfg: cfg, repos: repos, Workers: config.DefaultWorkers}
 	api.HandleFunc("GET /", api.ListApps)
+	api.HandleFunc("GET /desired", api.ListDesiredStates)
 	api.HandleFunc("GET /apps/{name}", api.GetApp)
 	api.HandleFunc("GET /apps/{name}/desired", api.GetAppConfig)
+	api.HandleFunc("GET /apps/{name}/diff", api.DiffEnvironments)
+	api.HandleFunc("POST /apps/{name}/refresh", api.RefreshApp)
 	api.HandleFunc("GET /apps/{name}/envs/{env}", api.GetEnvironment)
+	api.HandleFunc("GET /apps/{name}/envs/{env}/diff", api.DiffRenderedEnvironment)
+	api.HandleFunc("GET /apps/{name}/envs/{env}/manifests", api.GetManifests)
 	return api
 }
 
@@ -91,45 +352,46 @@ type envResponse struct {
 	Environment *config.Environment `json:"environment"`
 }
 
-type configSvcResponse struct {
-	Name   string   `json:"name"`
-	Images []string `json:"images"`
-}
-
-type configEnvResponse struct {
-	Name     string               `json:"name"`
-	RelPath  string               `json:"rel_path"`
-	Services []*configSvcResponse `json:"services"`
+type listConfigsResponse struct {
+	Apps []*configResponse `json:"apps"`
 }
 
 type configResponse struct {
-	Name         string               `json:"name"`
-	RepoURL      string               `json:"repo_url"`
-	Path         string               `json:"path"`
-	Environments []*configEnvResponse `json:"environments"`
+	Name         string                     `json:"name"`
+	RepoURL      string                     `json:"repo_url"`
+	Revision     string                     `json:"revision,omitempty"`
+	Path         string                     `json:"path"`
+	Environments []*config.EnvironmentState `json:"environments"`
 }
 
-func createConfigResponse(app *config.App, state map[string]map[string][]string) (*configResponse, error) {
-	r := &configResponse{
+// createConfigResponse combines the configured app with its parsed state, the
+// parsed state always includes the configured app.
+func createConfigResponse(app *config.App, rev string, state *config.AppState) *configResponse {
+	return &configResponse{
 		Name:         app.Name,
 		RepoURL:      app.RepoURL,
+		Revision:     rev,
 		Path:         app.Path,
-		Environments: []*configEnvResponse{},
-	}
-	err := app.EachEnvironment(func(env *config.Environment) error {
-		respEnv := &configEnvResponse{Name: env.Name, RelPath: env.RelPath, Services: []*configSvcResponse{}}
-		for svc, imgs := range state[env.Name] {
-			sort.Strings(imgs)
-			respSvc := &configSvcResponse{Name: svc, Images: []string{}}
-			respSvc.Images = append(respSvc.Images, imgs...)
-			respEnv.Services = append(respEnv.Services, respSvc)
-		}
-		r.Environments = append(r.Environments, respEnv)
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		Environments: state.Environments,
 	}
+}
 
-	return r, nil
+type renderDiffResponse struct {
+	App         string                 `json:"app"`
+	Environment string                 `json:"environment"`
+	Path        string                 `json:"path"`
+	Base        string                 `json:"base,omitempty"`
+	Head        string                 `json:"head,omitempty"`
+	BaseCommit  string                 `json:"base_commit,omitempty"`
+	HeadCommit  string                 `json:"head_commit,omitempty"`
+	Resources   []*render.ResourceDiff `json:"resources"`
+}
+
+// commitString returns the commit, or "" if the files weren't read from a
+// commit.
+func commitString(h plumbing.Hash) string {
+	if h.IsZero() {
+		return ""
+	}
+	return h.String()
 }
@@ -2,17 +2,30 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/repository"
 )
 
 func TestListApps(t *testing.T) {
-	ts := httptest.NewTLSServer(NewRouter(makeConfig()))
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
 	t.Cleanup(ts.Close)
 
 	res, err := ts.Client().Get(ts.URL)
@@ -30,7 +43,7 @@ func TestListApps(t *testing.T) {
 }
 
 func TestGetApp(t *testing.T) {
-	ts := httptest.NewTLSServer(NewRouter(makeConfig()))
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
 	t.Cleanup(ts.Close)
 
 	res, err := ts.Client().Get(ts.URL + "/apps/go-demo")
@@ -50,7 +63,7 @@ func TestGetApp(t *testing.T) {
 }
 
 func TestGetEnvironment(t *testing.T) {
-	ts := httptest.NewTLSServer(NewRouter(makeConfig()))
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
 	t.Cleanup(ts.Close)
 
 	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/envs/dev")
@@ -67,11 +80,12 @@ func TestGetEnvironment(t *testing.T) {
 
 func TestGetDesiredState(t *testing.T) {
 	cfg := makeConfig()
-	cfg.Apps[0].RepoURL = "../../"
+	repoURL, head := newTestRepository(t)
+	cfg.Apps[0].RepoURL = repoURL
 
 	// TODO: This should be mocked out, by decoupling the behaviour from the
 	// App model.
-	ts := httptest.NewTLSServer(NewRouter(cfg))
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
 	t.Cleanup(ts.Close)
 
 	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/desired")
@@ -81,38 +95,623 @@ func TestGetDesiredState(t *testing.T) {
 	assertJSONResponse(t, res, map[string]interface{}{
 		"name":     "go-demo",
 		"path":     "pkg/config/testdata/go-demo/base",
-		"repo_url": "../../",
+		"repo_url": repoURL,
 		"environments": []interface{}{
 			map[string]interface{}{
 				"name":     "dev",
-				"rel_path": "../overlays/dev",
-				"services": []interface{}{
-					map[string]interface{}{"images": []interface{}{"bigkevmcd/go-demo:latest"}, "name": "go-demo-http"},
-					map[string]interface{}{"images": []interface{}{"redis:6-alpine"}, "name": "redis"},
-				},
+				"path":     "pkg/config/testdata/go-demo/overlays/dev",
+				"commit":   head,
+				"services": goDemoServices("dev", "latest"),
 			},
 			map[string]interface{}{
 				"name":     "staging",
-				"rel_path": "../overlays/staging",
-				"services": []interface{}{
-					map[string]interface{}{"images": []interface{}{"bigkevmcd/go-demo:staging"}, "name": "go-demo-http"},
-					map[string]interface{}{"images": []interface{}{"redis:6-alpine"}, "name": "redis"},
-				},
+				"path":     "pkg/config/testdata/go-demo/overlays/staging",
+				"commit":   head,
+				"services": goDemoServices("staging", "staging"),
 			},
 			map[string]interface{}{
 				"name":     "production",
-				"rel_path": "../overlays/production",
-				"services": []interface{}{
-					map[string]interface{}{"images": []interface{}{"bigkevmcd/go-demo:production"}, "name": "go-demo-http"},
-					map[string]interface{}{"images": []interface{}{"redis:6-alpine"}, "name": "redis"},
+				"path":     "pkg/config/testdata/go-demo/overlays/production",
+				"commit":   head,
+				"services": goDemoServices("production", "production"),
+			},
+		},
+	})
+}
+
+func TestListDesiredStates(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = repoURL
+	cfg.Apps = append(cfg.Apps, &config.App{
+		Name:         "local-demo",
+		RepoURL:      "file://" + repoURL,
+		Path:         "pkg/config/testdata/go-demo/base",
+		Environments: []*config.Environment{{Name: "dev", RelPath: "../overlays/dev"}},
+	})
+	router := NewRouter(cfg, repository.New(nil))
+	router.Workers = 2
+	ts := httptest.NewTLSServer(router)
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/desired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	got := &listConfigsResponse{}
+	if err := json.NewDecoder(res.Body).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, v := range got.Apps {
+		names = append(names, v.Name)
+	}
+	if diff := cmp.Diff([]string{"go-demo", "local-demo"}, names); diff != "" {
+		t.Fatalf("apps were not returned in order:\n%s", diff)
+	}
+	if l := len(got.Apps[0].Environments); l != 3 {
+		t.Fatalf("got %d environments, want 3", l)
+	}
+}
+
+func TestListDesiredStatesWithFailingApp(t *testing.T) {
+	cfg := makeConfig()
+	cfg.Apps[0].RepoURL = "file:///tmp/unknown/repository"
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/desired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusInternalServerError)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "failed to read app go-demo") {
+		t.Fatalf("error didn't identify the app: %s", body)
+	}
+}
+
+func TestGetDesiredStateAtRevision(t *testing.T) {
+	cfg := makeConfig()
+	cfg.Apps[0].RepoURL, _ = newTestRepository(t)
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/desired?ref=HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	got := map[string]interface{}{}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["revision"] != "HEAD" {
+		t.Fatalf("got revision %#v, want %#v", got["revision"], "HEAD")
+	}
+}
+
+func TestGetDesiredStateFromLocalRepository(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/desired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	got := &configResponse{}
+	if err := json.NewDecoder(res.Body).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	images := map[string][]image.Reference{}
+	for _, svc := range got.Environments[0].Services {
+		images[svc.Name] = svc.Images
+	}
+	want := map[string][]image.Reference{
+		"go-demo": {image.MustParse("bigkevmcd/go-demo:latest")},
+		"redis":   {image.MustParse("redis:6-alpine")},
+	}
+	if diff := cmp.Diff(want, images); diff != "" {
+		t.Fatalf("failed to parse the local repository:\n%s", diff)
+	}
+}
+
+func TestGetDesiredStateWithUnknownRevision(t *testing.T) {
+	cfg := makeConfig()
+	cfg.Apps[0].RepoURL, _ = newTestRepository(t)
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/desired?ref=unknown-branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestGetDesiredStateWithUnknownApp(t *testing.T) {
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/unknown/desired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestDiffEnvironments(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/diff?from=dev&to=production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	got := &config.Diff{}
+	if err := json.NewDecoder(res.Body).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	dev, production := image.MustParse("bigkevmcd/go-demo:latest"), image.MustParse("bigkevmcd/go-demo:production")
+	want := &config.Diff{
+		App:  "go-demo",
+		From: "dev",
+		To:   "production",
+		Services: []*config.ServiceDiff{
+			{
+				Name:      "go-demo",
+				Change:    config.ServiceChanged,
+				Namespace: &config.NamespaceChange{From: "dev", To: "production"},
+				Images:    []*config.ImageChange{{Name: "docker.io/bigkevmcd/go-demo", From: &dev, To: &production}},
+			},
+			{
+				Name:      "redis",
+				Change:    config.ServiceChanged,
+				Namespace: &config.NamespaceChange{From: "dev", To: "production"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("failed to diff environments:\n%s", diff)
+	}
+}
+
+func TestDiffEnvironmentsWithUnknownEnvironment(t *testing.T) {
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	for _, u := range []string{"/apps/go-demo/diff?from=dev&to=unknown", "/apps/go-demo/diff?to=dev"} {
+		res, err := ts.Client().Get(ts.URL + u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s got status %v, want %v", u, res.StatusCode, http.StatusBadRequest)
+		}
+	}
+
+	res, err := ts.Client().Get(ts.URL + "/apps/unknown/diff?from=dev&to=staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestDiffRenderedEnvironment(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/envs/dev/diff?base=HEAD&head=HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	got := map[string]interface{}{}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["base_commit"] == "" || got["base_commit"] != got["head_commit"] {
+		t.Errorf("got base commit %v and head commit %v, want the same commit", got["base_commit"], got["head_commit"])
+	}
+	delete(got, "base_commit")
+	delete(got, "head_commit")
+	want := map[string]interface{}{
+		"app":         "go-demo",
+		"environment": "dev",
+		"path":        "pkg/config/testdata/go-demo/overlays/dev",
+		"base":        "HEAD",
+		"head":        "HEAD",
+		"resources":   []interface{}{},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("failed to diff the rendered environment:\n%s", diff)
+	}
+}
+
+func TestDiffRenderedEnvironmentWithUnknownEnvironment(t *testing.T) {
+	ts := httptest.NewTLSServer(NewRouter(makeConfig(), repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	for _, u := range []string{"/apps/go-demo/envs/unknown/diff", "/apps/unknown/envs/dev/diff"} {
+		res, err := ts.Client().Get(ts.URL + u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s got status %v, want %v", u, res.StatusCode, http.StatusNotFound)
+		}
+	}
+}
+
+func TestGetManifests(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/apps/go-demo/envs/dev/manifests?ref=HEAD&kind=deployment", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("got content-type %q, want %q", ct, "application/json")
+	}
+	resources := []struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&resources); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range resources {
+		got = append(got, r.Kind+" "+r.Metadata.Namespace+"/"+r.Metadata.Name)
+	}
+	want := []string{"Deployment dev/go-demo-http", "Deployment dev/redis"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("failed to get the manifests:\n%s", diff)
+	}
+}
+
+func TestGetManifestsAsYAML(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/envs/dev/manifests?ref=HEAD&kind=Service&name=redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("didn't get a successful response: %v", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/yaml" {
+		t.Fatalf("got content-type %q, want %q", ct, "application/yaml")
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "apiVersion: v1\nkind: Service\n") || strings.Contains(string(b), "---") {
+		t.Fatalf("got unexpected manifests:\n%s", b)
+	}
+}
+
+func TestGetManifestsNegotiatesTheContentType(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	acceptTests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/yaml"},
+		{"application/json", "application/json"},
+		{"application/yaml, application/json;q=0.1", "application/yaml"},
+		{"application/yaml;q=0.5, application/json", "application/json"},
+		{"text/html, application/*;q=0.2", "application/yaml"},
+		{"*/*;q=0.1, application/json", "application/json"},
+		{"application/json;q=0, */*", "application/yaml"},
+	}
+
+	for _, tt := range acceptTests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/apps/go-demo/envs/dev/manifests?ref=HEAD&kind=Service&name=redis", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			res, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if ct := res.Header.Get("Content-Type"); ct != tt.want {
+				t.Fatalf("got content-type %q, want %q", ct, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	negotiateTests := []struct {
+		accept []string
+		want   string
+	}{
+		{nil, "application/yaml"},
+		{[]string{"text/html"}, "application/yaml"},
+		{[]string{"application/json;q=0.9", "application/yaml;q=0.8"}, "application/json"},
+		{[]string{"application/json;q=invalid, application/yaml;q=0.1"}, "application/yaml"},
+		{[]string{"application/json;q=0.5, application/yaml;q=0.5"}, "application/yaml"},
+		{[]string{"not a media type, application/json"}, "application/json"},
+	}
+
+	for _, tt := range negotiateTests {
+		if got := negotiate(tt.accept, "application/yaml", "application/json"); got != tt.want {
+			t.Errorf("negotiate(%q) got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestGetManifestsWithInvalidSelector(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/apps/go-demo/envs/dev/manifests?ref=HEAD&selector=" + url.QueryEscape("app in (redis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestConcurrentEnvironmentRequests(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = "file://" + repoURL
+	ts := httptest.NewTLSServer(NewRouter(cfg, repository.New(nil)))
+	t.Cleanup(ts.Close)
+
+	paths := []string{
+		"/apps/go-demo/diff?from=dev&to=staging&ref=HEAD",
+		"/apps/go-demo/envs/staging/diff?base=HEAD&head=HEAD",
+		"/apps/go-demo/envs/production/manifests?ref=HEAD",
+	}
+	errs := make(chan error, len(paths)*2)
+	var wg sync.WaitGroup
+	for range 2 {
+		for _, p := range paths {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := ts.Client().Get(ts.URL + p)
+				if err != nil {
+					errs <- err
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					errs <- fmt.Errorf("%s got status %v, want %v", p, res.StatusCode, http.StatusOK)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRefreshApp(t *testing.T) {
+	cfg := makeConfig()
+	repoURL, _ := newTestRepository(t)
+	cfg.Apps[0].RepoURL = repoURL
+	repos := repository.New(nil)
+	ts := httptest.NewTLSServer(NewRouter(cfg, repos))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Post(ts.URL+"/apps/go-demo/refresh", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusNoContent)
+	}
+	if diff := cmp.Diff([]string{repoURL}, repos.URLs()); diff != "" {
+		t.Fatalf("repository was not fetched:\n%s", diff)
+	}
+}
+
+func goDemoServices(namespace, tag string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"name":      "go-demo",
+			"namespace": namespace,
+			"replicas":  1.0,
+			"kind":      "Deployment",
+			"images":    []interface{}{imageJSON("bigkevmcd/go-demo", tag)},
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name":       "http",
+					"role":       "main",
+					"image":      imageJSON("bigkevmcd/go-demo", tag),
+					"image_name": "bigkevmcd/go-demo:" + tag,
+					"ports":      []interface{}{map[string]interface{}{"container_port": 8080.0}},
+					"env_from":   []interface{}{"configmap/go-demo-config"},
+				},
+			},
+			"components": []interface{}{
+				map[string]interface{}{
+					"kind":     "Deployment",
+					"name":     "go-demo-http",
+					"replicas": 1.0,
+					"images":   []interface{}{imageJSON("bigkevmcd/go-demo", tag)},
+				},
+			},
+		},
+		map[string]interface{}{
+			"name":      "redis",
+			"namespace": namespace,
+			"replicas":  1.0,
+			"kind":      "Deployment",
+			"images":    []interface{}{imageJSON("library/redis", "6-alpine")},
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name":       "redis",
+					"role":       "main",
+					"image":      imageJSON("library/redis", "6-alpine"),
+					"image_name": "redis:6-alpine",
+					"ports":      []interface{}{map[string]interface{}{"container_port": 6379.0}},
+					"resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "100m", "memory": "100Mi"},
+					},
+				},
+			},
+			"components": []interface{}{
+				map[string]interface{}{
+					"kind":     "Deployment",
+					"name":     "redis",
+					"replicas": 1.0,
+					"images":   []interface{}{imageJSON("library/redis", "6-alpine")},
 				},
 			},
 		},
+	}
+}
+
+// imageJSON returns the decoded JSON for a tagged image in the default
+// registry.
+func imageJSON(repository, tag string) map[string]interface{} {
+	return map[string]interface{}{
+		"reference":  "docker.io/" + repository + ":" + tag,
+		"registry":   "docker.io",
+		"repository": repository,
+		"tag":        tag,
+	}
+}
+
+// newTestRepository creates a repository on disk with a commit of the go-demo
+// testdata, at the same path as in this repository, and returns the path of
+// the repository and the commit.
+func newTestRepository(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join("..", "config", "testdata", "go-demo")
+	err = filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, "pkg", "config", "testdata", "go-demo", rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(dest, b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := wt.Commit("Add the go-demo app", &git.CommitOptions{
+		Author: &object.Signature{Name: "Testing", Email: "testing@example.com", When: time.Now()},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, h.String()
 }
 
 func makeConfig() *config.Config {
-	return &config.Config{
+	cfg := &config.Config{
 		Apps: []*config.App{
 			{
 				Name:    "go-demo",
@@ -126,6 +725,10 @@ func makeConfig() *config.Config {
 			},
 		},
 	}
+	for _, a := range cfg.Apps {
+		a.LinkEnvironments()
+	}
+	return cfg
 }
 
 // TODO: assert the content-type.
@@ -0,0 +1,178 @@
+// Package image parses and normalises container image references.
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry for images that don't name one.
+	DefaultRegistry = "docker.io"
+	// DefaultTag is the tag for images that have neither a tag nor a digest.
+	DefaultTag = "latest"
+
+	officialRepositoryPrefix = "library/"
+)
+
+var (
+	repositoryRE = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRE        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRE     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+)
+
+// Reference is a normalised image reference.
+//
+// References are normalised in the same way as Docker, so "redis",
+// "redis:latest" and "docker.io/library/redis:latest" are equal:
+//
+//   - The Registry defaults to "docker.io", and "index.docker.io" is
+//     "docker.io".
+//   - Repositories in the default registry with a single component are in
+//     "library/".
+//   - The Tag defaults to "latest", unless there's a Digest.
+//
+// References are comparable, and can be used as map keys.
+type Reference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// Parse parses and normalises an image reference, e.g. "redis:6-alpine" or
+// "quay.io/org/app@sha256:...".
+func Parse(s string) (Reference, error) {
+	ref := Reference{}
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !digestRE.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("invalid digest in image %q", s)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !tagRE.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("invalid tag in image %q", s)
+		}
+	}
+	ref.Registry, ref.Repository = splitRegistry(name)
+	if ref.Registry == DefaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = officialRepositoryPrefix + ref.Repository
+	}
+	if !repositoryRE.MatchString(ref.Repository) {
+		return Reference{}, fmt.Errorf("invalid repository in image %q", s)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+	return ref, nil
+}
+
+// MustParse is like Parse, but panics if the reference can't be parsed.
+func MustParse(s string) Reference {
+	ref, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return ref
+}
+
+// ParseName parses and normalises an image name that has neither a tag nor a
+// digest, e.g. "quay.io/org/app", the Tag of the returned Reference is empty.
+func ParseName(s string) (Reference, error) {
+	if strings.Contains(s, "@") || strings.LastIndex(s, ":") > strings.LastIndex(s, "/") {
+		return Reference{}, fmt.Errorf("image name %q has a tag or digest", s)
+	}
+	ref, err := Parse(s)
+	if err != nil {
+		return Reference{}, err
+	}
+	ref.Tag = ""
+	return ref, nil
+}
+
+// ValidTag returns true if s can be used as the tag of an image.
+func ValidTag(s string) bool {
+	return tagRE.MatchString(s)
+}
+
+// ValidDigest returns true if s can be used as the digest of an image, e.g.
+// "sha256:...".
+func ValidDigest(s string) bool {
+	return digestRE.MatchString(s)
+}
+
+// splitRegistry splits the registry from the repository, the first component
+// of a name is only a registry if it looks like a hostname.
+func splitRegistry(name string) (string, string) {
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return DefaultRegistry, name
+	}
+	host := name[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return DefaultRegistry, name
+	}
+	host = strings.ToLower(host)
+	if host == "index.docker.io" {
+		host = DefaultRegistry
+	}
+	return host, name[i+1:]
+}
+
+// Name returns the registry and repository, without the tag or digest, e.g.
+// "docker.io/library/redis".
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the full normalised reference, e.g.
+// "docker.io/library/redis:6-alpine".
+func (r Reference) String() string {
+	return r.Name() + r.suffix()
+}
+
+// Familiar returns the shortest form of the reference, omitting the default
+// registry, e.g. "redis:6-alpine".
+func (r Reference) Familiar() string {
+	name := r.Name()
+	if r.Registry == DefaultRegistry {
+		name = strings.TrimPrefix(r.Repository, officialRepositoryPrefix)
+	}
+	return name + r.suffix()
+}
+
+func (r Reference) suffix() string {
+	s := ""
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// IsZero returns true for the zero Reference, which isn't an image.
+func (r Reference) IsZero() bool {
+	return r == Reference{}
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// The normalised reference is included along with its parts, the zero
+// Reference is null.
+func (r Reference) MarshalJSON() ([]byte, error) {
+	if r.IsZero() {
+		return []byte("null"), nil
+	}
+	type parts Reference
+	return json.Marshal(struct {
+		Reference string `json:"reference"`
+		parts
+	}{Reference: r.String(), parts: parts(r)})
+}
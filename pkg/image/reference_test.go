@@ -0,0 +1,173 @@
+package image
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testDigest = "sha256:2f9bc84bb4c5ad7ba9b8b4fe1b1a6a8e3ee4d6c4b1a6e0e9b0c7ef4a4b5c6d7e"
+
+func TestParse(t *testing.T) {
+	parseTests := []struct {
+		image string
+		want  Reference
+	}{
+		{"redis", Reference{Registry: "docker.io", Repository: "library/redis", Tag: "latest"}},
+		{"redis:6-alpine", Reference{Registry: "docker.io", Repository: "library/redis", Tag: "6-alpine"}},
+		{"docker.io/library/redis:latest", Reference{Registry: "docker.io", Repository: "library/redis", Tag: "latest"}},
+		{"index.docker.io/library/redis", Reference{Registry: "docker.io", Repository: "library/redis", Tag: "latest"}},
+		{"bigkevmcd/go-demo:876ecb3", Reference{Registry: "docker.io", Repository: "bigkevmcd/go-demo", Tag: "876ecb3"}},
+		{"redis@" + testDigest, Reference{Registry: "docker.io", Repository: "library/redis", Digest: testDigest}},
+		{"quay.io/org/app:v1@" + testDigest, Reference{Registry: "quay.io", Repository: "org/app", Tag: "v1", Digest: testDigest}},
+		{"Registry.Example.com:5000/team/app", Reference{Registry: "registry.example.com:5000", Repository: "team/app", Tag: "latest"}},
+		{"localhost/app:dev", Reference{Registry: "localhost", Repository: "app", Tag: "dev"}},
+	}
+
+	for _, tt := range parseTests {
+		got, err := Parse(tt.image)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", tt.image, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Parse(%q) failed:\n%s", tt.image, diff)
+		}
+	}
+}
+
+func TestParseInvalidReferences(t *testing.T) {
+	invalid := []string{
+		"",
+		"Redis",
+		"redis:",
+		"redis:-bad",
+		"redis@sha256:short",
+		"example.com/",
+		"example.com/app//name",
+	}
+
+	for _, v := range invalid {
+		if ref, err := Parse(v); err == nil {
+			t.Errorf("Parse(%q) got %#v, want an error", v, ref)
+		}
+	}
+}
+
+func TestReferenceStrings(t *testing.T) {
+	stringTests := []struct {
+		image        string
+		wantString   string
+		wantFamiliar string
+		wantName     string
+	}{
+		{"redis", "docker.io/library/redis:latest", "redis:latest", "docker.io/library/redis"},
+		{"bigkevmcd/go-demo:v1", "docker.io/bigkevmcd/go-demo:v1", "bigkevmcd/go-demo:v1", "docker.io/bigkevmcd/go-demo"},
+		{"quay.io/org/app@" + testDigest, "quay.io/org/app@" + testDigest, "quay.io/org/app@" + testDigest, "quay.io/org/app"},
+	}
+
+	for _, tt := range stringTests {
+		ref := MustParse(tt.image)
+		if s := ref.String(); s != tt.wantString {
+			t.Errorf("String() got %q, want %q", s, tt.wantString)
+		}
+		if s := ref.Familiar(); s != tt.wantFamiliar {
+			t.Errorf("Familiar() got %q, want %q", s, tt.wantFamiliar)
+		}
+		if s := ref.Name(); s != tt.wantName {
+			t.Errorf("Name() got %q, want %q", s, tt.wantName)
+		}
+		if reparsed := MustParse(ref.String()); reparsed != ref {
+			t.Errorf("%q didn't round-trip: got %#v", ref, reparsed)
+		}
+	}
+}
+
+func TestReferencesAreEqualAfterNormalisation(t *testing.T) {
+	if MustParse("redis") != MustParse("docker.io/library/redis:latest") {
+		t.Fatal("normalised references are not equal")
+	}
+	if MustParse("redis:6") == MustParse("redis:7") {
+		t.Fatal("different tags are equal")
+	}
+}
+
+func TestReferenceJSON(t *testing.T) {
+	b, err := json.Marshal(MustParse("redis:6-alpine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"reference":"docker.io/library/redis:6-alpine","registry":"docker.io","repository":"library/redis","tag":"6-alpine"}`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("failed to marshal:\n%s", diff)
+	}
+
+	var ref Reference
+	if err := json.Unmarshal(b, &ref); err != nil {
+		t.Fatal(err)
+	}
+	if ref != MustParse("redis:6-alpine") {
+		t.Fatalf("failed to unmarshal: %#v", ref)
+	}
+}
+
+func TestZeroReferenceJSON(t *testing.T) {
+	if !(Reference{}).IsZero() || MustParse("redis").IsZero() {
+		t.Fatal("only the zero Reference should be zero")
+	}
+	b, err := json.Marshal(struct {
+		Image Reference `json:"image"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`{"image":null}`, string(b)); diff != "" {
+		t.Fatalf("failed to marshal:\n%s", diff)
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustParse to panic")
+		}
+	}()
+	MustParse("Invalid")
+}
+
+func TestParseName(t *testing.T) {
+	nameTests := []struct {
+		name string
+		want Reference
+	}{
+		{"redis", Reference{Registry: "docker.io", Repository: "library/redis"}},
+		{"registry.example.com:5000/team/app", Reference{Registry: "registry.example.com:5000", Repository: "team/app"}},
+	}
+
+	for _, tt := range nameTests {
+		got, err := ParseName(tt.name)
+		if err != nil {
+			t.Errorf("ParseName(%q) failed: %s", tt.name, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ParseName(%q) failed:\n%s", tt.name, diff)
+		}
+	}
+
+	for _, v := range []string{"redis:6-alpine", "redis@" + testDigest, "Redis"} {
+		if ref, err := ParseName(v); err == nil {
+			t.Errorf("ParseName(%q) got %#v, want an error", v, ref)
+		}
+	}
+}
+
+func TestValidTagAndDigest(t *testing.T) {
+	if !ValidTag("v1.2.3") || ValidTag("-bad") || ValidTag("") {
+		t.Error("ValidTag didn't validate tags")
+	}
+	if !ValidDigest(testDigest) || ValidDigest("sha256:short") || ValidDigest("v1.2.3") {
+		t.Error("ValidDigest didn't validate digests")
+	}
+}
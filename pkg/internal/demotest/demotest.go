@@ -0,0 +1,43 @@
+// Package demotest provides the demo app that's shared by the tests of the
+// packages that change kustomizations.
+//
+// The demo app's repository has a base with "http", "redis" and "worker"
+// services, and "staging" and "production" overlays.
+package demotest
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+// App returns the demo app, with its environments linked.
+func App() *config.App {
+	app := &config.App{
+		Name: "demo",
+		Path: "demo/base",
+		Environments: []*config.Environment{
+			{Name: "staging", RelPath: "../overlays/staging"},
+			{Name: "production", RelPath: "../overlays/production"},
+		},
+	}
+	app.LinkEnvironments()
+	return app
+}
+
+// Files returns an overlay on the demo app's repository, so that each test
+// can change the files without affecting the others.
+func Files() *gitfs.Overlay {
+	_, filename, _, _ := runtime.Caller(0)
+	return gitfs.NewOverlay(gitfs.NewDir(filepath.Join(filepath.Dir(filename), "testdata")))
+}
+
+// ImageChange returns the change of the named image between two references,
+// it panics if either reference can't be parsed.
+func ImageChange(name, from, to string) *config.ImageChange {
+	f, t := image.MustParse(from), image.MustParse(to)
+	return &config.ImageChange{Name: name, From: &f, To: &t}
+}
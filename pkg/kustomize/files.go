@@ -0,0 +1,66 @@
+package kustomize
+
+import (
+	"fmt"
+	"path"
+
+	"sigs.k8s.io/kustomize/api/pkg/util"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// kustomizationFiles are the names that Kustomize accepts for a
+// kustomization, in the order that it looks for them.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// ReadKustomization reads the kustomization in a directory, and returns a
+// Kustomizer for editing it, along with the path of the file that it was read
+// from.
+func ReadKustomization(files filesys.FileSystem, dir string) (string, *Kustomizer, error) {
+	filename := ""
+	for _, name := range kustomizationFiles {
+		if p := path.Join(dir, name); files.Exists(p) {
+			filename = p
+			break
+		}
+	}
+	if filename == "" {
+		return "", nil, fmt.Errorf("no kustomization found in %s", dir)
+	}
+	b, err := files.ReadFile(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	k, err := ParseKustomizer(b)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return filename, k, nil
+}
+
+// WriteKustomization writes the edited kustomization to a file.
+func WriteKustomization(files filesys.FileSystem, filename string, k *Kustomizer) error {
+	b, err := k.YAML()
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filename, err)
+	}
+	return files.WriteFile(filename, b)
+}
+
+// OverrideName returns the name of the image override for an image that's
+// rendered by a kustomization, the image is as it's written in the rendered
+// manifests, e.g. "docker.io/library/redis:6".
+//
+// Kustomize matches the names of overrides exactly, without normalising them,
+// so "redis" doesn't match "docker.io/library/redis:6". If the kustomization
+// already overrides the image, possibly renaming it, the existing override's
+// name is used, otherwise it's the rendered image without its tag or digest.
+func OverrideName(k *types.Kustomization, rendered string) string {
+	name, _, _ := util.SplitImageName(rendered)
+	for _, v := range k.Images {
+		if v.NewName == name || (v.NewName == "" && v.Name == name) {
+			return v.Name
+		}
+	}
+	return name
+}
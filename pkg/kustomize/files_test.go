@@ -0,0 +1,117 @@
+package kustomize
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+func TestReadAndWriteKustomization(t *testing.T) {
+	files := filesys.MakeFsInMemory()
+	fatalIfError(t, files.WriteFile("/app/kustomization.yml", []byte("namespace: dev\nimages:\n- name: redis\n  newTag: 6-alpine\n")))
+
+	filename, k, err := ReadKustomization(files, "/app")
+	fatalIfError(t, err)
+
+	if filename != "/app/kustomization.yml" {
+		t.Fatalf("got filename %q", filename)
+	}
+	want := &types.Kustomization{Namespace: "dev", Images: []types.Image{{Name: "redis", NewTag: "6-alpine"}}}
+	if diff := cmp.Diff(want, k.Kustomization()); diff != "" {
+		t.Fatalf("Kustomization didn't match:\n%s", diff)
+	}
+
+	fatalIfError(t, k.AddImageOverride("redis", "6.2-alpine"))
+	fatalIfError(t, WriteKustomization(files, filename, k))
+	b, err := files.ReadFile(filename)
+	fatalIfError(t, err)
+	if diff := cmp.Diff("namespace: dev\nimages:\n- name: redis\n  newTag: 6.2-alpine\n", string(b)); diff != "" {
+		t.Fatalf("written kustomization didn't match:\n%s", diff)
+	}
+}
+
+func TestReadKustomizationWithInvalidYAML(t *testing.T) {
+	files := filesys.MakeFsInMemory()
+	fatalIfError(t, files.WriteFile("/app/kustomization.yaml", []byte("images: redis\n")))
+
+	_, _, err := ReadKustomization(files, "/app")
+
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to parse /app/kustomization.yaml:") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestReadKustomizationWithMissingFile(t *testing.T) {
+	_, _, err := ReadKustomization(filesys.MakeFsInMemory(), "/app")
+
+	if err == nil || err.Error() != "no kustomization found in /app" {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestOverrideName(t *testing.T) {
+	k := &types.Kustomization{
+		Images: []types.Image{
+			{Name: "example.com/http", NewTag: "v1.0.0"},
+			{Name: "worker", NewName: "quay.io/my-org/worker"},
+			{Name: "redis", NewTag: "6-alpine"},
+		},
+	}
+
+	tests := []struct {
+		rendered string
+		want     string
+	}{
+		{"example.com/http:v1.0.0", "example.com/http"},
+		{"quay.io/my-org/worker:v2", "worker"},
+		{"redis:6-alpine", "redis"},
+		{"docker.io/library/redis:6-alpine", "docker.io/library/redis"},
+		{"docker.io/library/busybox:1.36", "docker.io/library/busybox"},
+		{"registry.example.com:5000/api@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "registry.example.com:5000/api"},
+	}
+	for _, tt := range tests {
+		if got := OverrideName(k, tt.rendered); got != tt.want {
+			t.Errorf("OverrideName(%q) got %q, want %q", tt.rendered, got, tt.want)
+		}
+	}
+}
+
+func TestReadKustomizationWithEveryField(t *testing.T) {
+	files := filesys.MakeFsOnDisk()
+	src, err := files.ReadFile("testdata/modern/kustomization.yaml")
+	fatalIfError(t, err)
+
+	filename, k, err := ReadKustomization(files, "testdata/modern")
+	fatalIfError(t, err)
+
+	// Every field is parsed, so none of them can be lost when the
+	// kustomization is written.
+	v := reflect.ValueOf(*k.Kustomization())
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Errorf("field %s wasn't parsed", v.Type().Field(i).Name)
+		}
+	}
+	if diff := cmp.Diff(k.Kustomization(), NewKustomizer(k.Kustomization()).Kustomization(), cmpopts.EquateComparable(resid.Gvk{})); diff != "" {
+		t.Fatalf("Kustomization didn't round-trip:\n%s", diff)
+	}
+
+	fatalIfError(t, k.AddImageOverride("redis", "6.2-alpine"))
+	fatalIfError(t, k.SetImageDigest("worker", testDigest))
+	memory := filesys.MakeFsInMemory()
+	fatalIfError(t, WriteKustomization(memory, filename, k))
+	b, err := memory.ReadFile(filename)
+	fatalIfError(t, err)
+
+	want := strings.Replace(string(src), "newTag: 6-alpine #", "newTag: 6.2-alpine #", 1)
+	want = strings.Replace(want, "    tagSuffix: -debug\n", "    tagSuffix: -debug\n  - name: worker\n    digest: "+testDigest+"\n", 1)
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("written kustomization didn't match:\n%s", diff)
+	}
+}
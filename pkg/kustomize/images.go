@@ -0,0 +1,83 @@
+package kustomize
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+// containerKeys are the fields of pod specs that list containers.
+var containerKeys = map[string]bool{
+	"initContainers":      true,
+	"containers":          true,
+	"ephemeralContainers": true,
+}
+
+// RenderedImages renders the kustomization in a directory, and returns the
+// sorted images of the containers in the rendered resources, as they're
+// written.
+func RenderedImages(files filesys.FileSystem, dir string) ([]string, error) {
+	resMap, err := parser.ParseTreeToResMap(dir, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", dir, err)
+	}
+	images := []string{}
+	for _, r := range resMap.Resources() {
+		data, err := r.Map()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the data of %s: %w", r.CurId(), err)
+		}
+		images = appendContainerImages(images, data, false)
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// CheckImages renders the kustomization in a directory, and returns an error
+// if any of the images isn't rendered.
+//
+// This catches image overrides that Kustomize doesn't apply, because their
+// names don't match the images in the manifests, the images are compared
+// after they're normalised.
+func CheckImages(files filesys.FileSystem, dir string, want ...image.Reference) error {
+	rendered, err := RenderedImages(files, dir)
+	if err != nil {
+		return err
+	}
+	found := map[image.Reference]bool{}
+	for _, v := range rendered {
+		if ref, err := image.Parse(v); err == nil {
+			found[ref] = true
+		}
+	}
+	for _, v := range want {
+		if !found[v] {
+			return fmt.Errorf("%s isn't rendered by %s, the image override wasn't applied", v.Familiar(), dir)
+		}
+	}
+	return nil
+}
+
+// appendContainerImages appends the images of the containers within a value,
+// inContainers is true for the elements of a list of containers.
+func appendContainerImages(images []string, v interface{}, inContainers bool) []string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if s, ok := child.(string); ok && inContainers && k == "image" {
+				images = append(images, s)
+				continue
+			}
+			images = appendContainerImages(images, child, containerKeys[k])
+		}
+	case []interface{}:
+		for _, child := range v {
+			images = appendContainerImages(images, child, inContainers)
+		}
+	}
+	return images
+}
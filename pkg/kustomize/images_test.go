@@ -0,0 +1,79 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: redis
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.36
+      containers:
+      - name: redis
+        image: docker.io/library/redis:6
+`
+
+func TestRenderedImages(t *testing.T) {
+	files := testFiles(t, "resources:\n- deployment.yaml\n")
+
+	images, err := RenderedImages(files, "/app")
+	fatalIfError(t, err)
+
+	if diff := cmp.Diff([]string{"busybox:1.36", "docker.io/library/redis:6"}, images); diff != "" {
+		t.Fatalf("rendered images didn't match:\n%s", diff)
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	checkTests := []struct {
+		name          string
+		kustomization string
+		wantErr       string
+	}{
+		{
+			"override with the name in the manifest",
+			"resources:\n- deployment.yaml\nimages:\n- name: docker.io/library/redis\n  newTag: \"7\"\n",
+			"",
+		},
+		{
+			"override with a normalised name",
+			"resources:\n- deployment.yaml\nimages:\n- name: redis\n  newTag: \"7\"\n",
+			"redis:7 isn't rendered by /app, the image override wasn't applied",
+		},
+	}
+
+	for _, tt := range checkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := testFiles(t, tt.kustomization)
+
+			err := CheckImages(files, "/app", image.MustParse("busybox:1.36"), image.MustParse("redis:7"))
+
+			if tt.wantErr == "" {
+				fatalIfError(t, err)
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func testFiles(t *testing.T, kustomization string) filesys.FileSystem {
+	t.Helper()
+	files := filesys.MakeFsInMemory()
+	fatalIfError(t, files.WriteFile("/app/kustomization.yaml", []byte(kustomization)))
+	fatalIfError(t, files.WriteFile("/app/deployment.yaml", []byte(testDeployment)))
+	return files
+}
@@ -1,42 +1,227 @@
 package kustomize
 
 import (
-	"sigs.k8s.io/kustomize/v3/pkg/image"
-	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"errors"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
 )
 
+const imagesField = "images"
+
+// Kustomizer edits a kustomization.
+//
+// The kustomization is edited as YAML nodes, so the comments, the order of
+// the fields and the image overrides, and the indentation of sequences are
+// kept when it's written, and only the edited fields change.
 type Kustomizer struct {
-	imageOverrides map[string]image.Image
-	src            *types.Kustomization
+	node      *yaml.RNode
+	seqIndent yaml.SequenceIndentStyle
 }
 
 // NewKustomizer creates and returns a new Kustomizer for manipulating
 // Kustomization files.
+//
+// Use ParseKustomizer to keep the formatting of an existing file.
 func NewKustomizer(k *types.Kustomization) *Kustomizer {
-	imageOverrides := map[string]image.Image{}
-	for _, v := range k.Images {
-		imageOverrides[v.Name] = v
+	b, err := sigsyaml.Marshal(k)
+	if err != nil {
+		// A Kustomization has no fields that can't be marshalled.
+		panic(err)
 	}
-	return &Kustomizer{
-		src:            k,
-		imageOverrides: imageOverrides,
+	node := yaml.MustParse(string(b))
+	// An empty Kustomization is marshalled as "{}".
+	node.YNode().Style = 0
+	return &Kustomizer{node: node}
+}
+
+// ParseKustomizer parses the YAML of a kustomization, and returns a new
+// Kustomizer for editing it.
+func ParseKustomizer(b []byte) (*Kustomizer, error) {
+	if err := sigsyaml.Unmarshal(b, &types.Kustomization{}); err != nil {
+		return nil, err
+	}
+	node, err := yaml.Parse(string(b))
+	if errors.Is(err, io.EOF) {
+		// The file has no YAML documents.
+		node, err = yaml.NewMapRNode(nil), nil
+	}
+	if err != nil {
+		return nil, err
 	}
+	if node.YNode().Kind != yaml.MappingNode {
+		return nil, errors.New("kustomization is not a map")
+	}
+	if len(node.Content()) == 0 {
+		node.YNode().Style = 0
+	}
+	return &Kustomizer{
+		node:      node,
+		seqIndent: yaml.SequenceIndentStyle(yaml.DeriveSeqIndentStyle(string(b))),
+	}, nil
 }
 
 // AddImageOverride adds an override for a specific image.
 //
-// Existing overrides for the same image are replaced.
+// Existing overrides for the same image are updated, keeping the new name if
+// the existing override renames the image, a digest is removed, as the image
+// would still be pinned to it, and a tag suffix is removed, as Kustomize
+// ignores it when there's a new tag.
+//
+// New overrides are added after the existing overrides.
 func (k *Kustomizer) AddImageOverride(srcImage, newTag string) error {
-	k.imageOverrides[srcImage] = image.Image{Name: srcImage, NewTag: newTag}
-	return nil
+	if !image.ValidTag(newTag) {
+		return fmt.Errorf("invalid tag %q for image %s", newTag, srcImage)
+	}
+	return k.updateImageOverride(srcImage, func(n *yaml.RNode) error {
+		if err := setString(n, "newTag", newTag); err != nil {
+			return err
+		}
+		if err := n.PipeE(yaml.Clear("digest")); err != nil {
+			return err
+		}
+		return n.PipeE(yaml.Clear("tagSuffix"))
+	})
+}
+
+// SetImageName adds an override that renames an image, e.g. when it's
+// moved to another registry.
+//
+// The tag or digest of an existing override for the image is kept.
+func (k *Kustomizer) SetImageName(srcImage, newName string) error {
+	if _, err := image.ParseName(newName); err != nil {
+		return err
+	}
+	return k.updateImageOverride(srcImage, func(n *yaml.RNode) error {
+		return setString(n, "newName", newName)
+	})
+}
+
+// SetImageDigest adds an override that pins an image to a digest.
+//
+// The new name and tag of an existing override for the image are kept,
+// Kustomize writes images with both a tag and a digest as "name:tag@digest",
+// and a tag suffix is removed, as Kustomize ignores it when there's a digest.
+func (k *Kustomizer) SetImageDigest(srcImage, digest string) error {
+	if !image.ValidDigest(digest) {
+		return fmt.Errorf("invalid digest %q for image %s", digest, srcImage)
+	}
+	return k.updateImageOverride(srcImage, func(n *yaml.RNode) error {
+		if err := setString(n, "digest", digest); err != nil {
+			return err
+		}
+		return n.PipeE(yaml.Clear("tagSuffix"))
+	})
+}
+
+// RemoveImageOverride removes the override for an image, it's not an error
+// if the image has no override.
+//
+// The images field is removed if the last override is removed.
+func (k *Kustomizer) RemoveImageOverride(srcImage string) {
+	images := k.node.Field(imagesField)
+	if images == nil || images.Value.YNode().Kind != yaml.SequenceNode {
+		return
+	}
+	content := images.Value.YNode().Content
+	kept := content[:0]
+	for _, v := range content {
+		if name, _ := yaml.NewRNode(v).GetString("name"); name != srcImage {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == len(content) {
+		return
+	}
+	images.Value.YNode().Content = kept
+	if len(kept) == 0 {
+		// Clearing a field that exists can't fail.
+		_ = k.node.PipeE(yaml.Clear(imagesField))
+	}
+}
+
+// ImageOverride returns the override for an image, and whether or not there
+// is one.
+func (k *Kustomizer) ImageOverride(srcImage string) (types.Image, bool) {
+	for _, v := range k.Kustomization().Images {
+		if v.Name == srcImage {
+			return v, true
+		}
+	}
+	return types.Image{}, false
 }
 
 // Kustomization gets the updated configuration.
 func (k *Kustomizer) Kustomization() *types.Kustomization {
-	images := []image.Image{}
-	for _, v := range k.imageOverrides {
-		images = append(images, v)
+	kz := &types.Kustomization{}
+	// The YAML was a valid Kustomization when it was parsed, and the
+	// operations only write strings to the image overrides.
+	if err := sigsyaml.Unmarshal([]byte(k.node.MustString()), kz); err != nil {
+		panic(err)
+	}
+	return kz
+}
+
+// YAML returns the updated YAML of the kustomization.
+func (k *Kustomizer) YAML() ([]byte, error) {
+	return yaml.MarshalWithOptions(k.node.Document(), &yaml.EncoderOptions{SeqIndent: k.seqIndent})
+}
+
+// updateImageOverride calls f with the override for an image, adding a new
+// override if there isn't one.
+func (k *Kustomizer) updateImageOverride(srcImage string, f func(*yaml.RNode) error) error {
+	if _, err := image.ParseName(srcImage); err != nil {
+		return err
+	}
+	images, err := k.node.Pipe(yaml.LookupCreate(yaml.SequenceNode, imagesField))
+	if err != nil {
+		return err
+	}
+	if images.IsTaggedNull() {
+		// "images:" and "images: null" are empty lists.
+		images.YNode().Kind = yaml.SequenceNode
+		images.YNode().Tag = yaml.NodeTagSeq
+		images.YNode().Value = ""
+	}
+	if images.YNode().Kind != yaml.SequenceNode {
+		return fmt.Errorf("the %s of the kustomization is not a list", imagesField)
+	}
+	elements, err := images.Elements()
+	if err != nil {
+		return err
+	}
+	for _, v := range elements {
+		if name, _ := v.GetString("name"); name == srcImage {
+			return f(v)
+		}
+	}
+	override := yaml.NewMapRNode(nil)
+	if err := setString(override, "name", srcImage); err != nil {
+		return err
+	}
+	if err := f(override); err != nil {
+		return err
+	}
+	if len(elements) == 0 {
+		// Empty sequences are often written as "[]".
+		images.YNode().Style = 0
+	}
+	images.YNode().Content = append(images.YNode().Content, override.YNode())
+	return nil
+}
+
+// setString sets a field to a string, an existing value is updated in place
+// to keep its comments and quoting.
+func setString(n *yaml.RNode, field, value string) error {
+	if f := n.Field(field); f != nil && f.Value.YNode().Kind == yaml.ScalarNode {
+		f.Value.YNode().Value = value
+		f.Value.YNode().Tag = yaml.NodeTagString
+		return nil
 	}
-	k.src.Images = images
-	return k.src
+	return n.PipeE(yaml.SetField(field, yaml.NewStringRNode(value)))
 }
@@ -3,12 +3,13 @@ package kustomize
 import (
 	"testing"
 
-	"sigs.k8s.io/kustomize/v3/pkg/image"
-	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/kustomize/api/types"
 
 	"github.com/google/go-cmp/cmp"
 )
 
+const testDigest = "sha256:2f9bc84bb4c5ad7ba9b8b4fe1b1a6a8e3ee4d6c4b1a6e0e9b0c7ef4a4b5c6d7e"
+
 func TestAddImageOverride(t *testing.T) {
 	k := createKustomizer()
 
@@ -16,7 +17,7 @@ func TestAddImageOverride(t *testing.T) {
 	fatalIfError(t, err)
 
 	want := &types.Kustomization{
-		Images: []image.Image{
+		Images: []types.Image{
 			{Name: "test/built-image", NewTag: "ef7bebf8bdb1919d947afe46ab4b2fb4278039b3"},
 		},
 	}
@@ -32,7 +33,7 @@ func TestOverrideImageUpdatesExistingOverride(t *testing.T) {
 	fatalIfError(t, k.AddImageOverride("test/built-image", "6d56c1750f65b4f648040959313c5004e5c351cb"))
 
 	want := &types.Kustomization{
-		Images: []image.Image{
+		Images: []types.Image{
 			{Name: "test/built-image", NewTag: "6d56c1750f65b4f648040959313c5004e5c351cb"},
 		},
 	}
@@ -41,6 +42,236 @@ func TestOverrideImageUpdatesExistingOverride(t *testing.T) {
 	}
 }
 
+func TestOverrideImageKeepsNewName(t *testing.T) {
+	k := NewKustomizer(&types.Kustomization{
+		Images: []types.Image{
+			{Name: "test/built-image", NewName: "quay.io/test/built-image", NewTag: "v1"},
+			{Name: "redis", NewTag: "6-alpine"},
+		},
+	})
+
+	fatalIfError(t, k.AddImageOverride("test/built-image", "v2"))
+
+	want := &types.Kustomization{
+		Images: []types.Image{
+			{Name: "test/built-image", NewName: "quay.io/test/built-image", NewTag: "v2"},
+			{Name: "redis", NewTag: "6-alpine"},
+		},
+	}
+	if diff := cmp.Diff(want, k.Kustomization()); diff != "" {
+		t.Fatalf("Kustomization didn't match:\n%s", diff)
+	}
+}
+
+func TestOverrideImageRemovesDigest(t *testing.T) {
+	k := NewKustomizer(&types.Kustomization{
+		Images: []types.Image{
+			{Name: "redis", NewName: "quay.io/mirror/redis", Digest: testDigest},
+		},
+	})
+
+	fatalIfError(t, k.AddImageOverride("redis", "6-alpine"))
+
+	want := &types.Kustomization{
+		Images: []types.Image{
+			{Name: "redis", NewName: "quay.io/mirror/redis", NewTag: "6-alpine"},
+		},
+	}
+	if diff := cmp.Diff(want, k.Kustomization()); diff != "" {
+		t.Fatalf("Kustomization didn't match:\n%s", diff)
+	}
+}
+
+func TestImageOverrideOperations(t *testing.T) {
+	operationTests := []struct {
+		name     string
+		existing []types.Image
+		op       func(*Kustomizer) error
+		want     []types.Image
+	}{
+		{
+			"setting a name keeps the tag",
+			[]types.Image{{Name: "redis", NewTag: "6-alpine"}},
+			func(k *Kustomizer) error { return k.SetImageName("redis", "quay.io/mirror/redis") },
+			[]types.Image{{Name: "redis", NewName: "quay.io/mirror/redis", NewTag: "6-alpine"}},
+		},
+		{
+			"setting a name keeps the digest",
+			[]types.Image{{Name: "redis", Digest: testDigest}},
+			func(k *Kustomizer) error { return k.SetImageName("redis", "quay.io/mirror/redis") },
+			[]types.Image{{Name: "redis", NewName: "quay.io/mirror/redis", Digest: testDigest}},
+		},
+		{
+			"setting a name without an existing override",
+			nil,
+			func(k *Kustomizer) error { return k.SetImageName("redis", "quay.io/mirror/redis") },
+			[]types.Image{{Name: "redis", NewName: "quay.io/mirror/redis"}},
+		},
+		{
+			"setting a digest keeps the tag",
+			[]types.Image{{Name: "redis", NewName: "quay.io/mirror/redis", NewTag: "6-alpine"}},
+			func(k *Kustomizer) error { return k.SetImageDigest("redis", testDigest) },
+			[]types.Image{{Name: "redis", NewName: "quay.io/mirror/redis", NewTag: "6-alpine", Digest: testDigest}},
+		},
+		{
+			"setting a digest removes the tag suffix",
+			[]types.Image{{Name: "redis", TagSuffix: "-alpine"}},
+			func(k *Kustomizer) error { return k.SetImageDigest("redis", testDigest) },
+			[]types.Image{{Name: "redis", Digest: testDigest}},
+		},
+		{
+			"setting a tag removes the tag suffix",
+			[]types.Image{{Name: "redis", TagSuffix: "-alpine"}},
+			func(k *Kustomizer) error { return k.AddImageOverride("redis", "6.2-alpine") },
+			[]types.Image{{Name: "redis", NewTag: "6.2-alpine"}},
+		},
+		{
+			"removing an override keeps the others",
+			[]types.Image{{Name: "redis", NewTag: "6-alpine"}, {Name: "test/built-image", NewTag: "v1"}},
+			func(k *Kustomizer) error { k.RemoveImageOverride("redis"); return nil },
+			[]types.Image{{Name: "test/built-image", NewTag: "v1"}},
+		},
+		{
+			"removing a missing override",
+			[]types.Image{{Name: "redis", NewTag: "6-alpine"}},
+			func(k *Kustomizer) error { k.RemoveImageOverride("test/built-image"); return nil },
+			[]types.Image{{Name: "redis", NewTag: "6-alpine"}},
+		},
+	}
+
+	for _, tt := range operationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKustomizer(&types.Kustomization{Images: tt.existing})
+
+			fatalIfError(t, tt.op(k))
+
+			if diff := cmp.Diff(&types.Kustomization{Images: tt.want}, k.Kustomization()); diff != "" {
+				t.Fatalf("Kustomization didn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImageOverrideOperationsWithInvalidValues(t *testing.T) {
+	invalidTests := []struct {
+		name string
+		op   func(*Kustomizer) error
+	}{
+		{"invalid tag", func(k *Kustomizer) error { return k.AddImageOverride("redis", "-bad") }},
+		{"invalid image", func(k *Kustomizer) error { return k.AddImageOverride("Redis", "6-alpine") }},
+		{"name with a tag", func(k *Kustomizer) error { return k.SetImageName("redis", "quay.io/mirror/redis:6") }},
+		{"invalid digest", func(k *Kustomizer) error { return k.SetImageDigest("redis", "sha256:short") }},
+	}
+
+	for _, tt := range invalidTests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := createKustomizer()
+
+			if err := tt.op(k); err == nil {
+				t.Fatal("expected an error")
+			}
+			if _, ok := k.ImageOverride("redis"); ok {
+				t.Fatal("override was added")
+			}
+		})
+	}
+}
+
+func TestKustomizerKeepsFormatting(t *testing.T) {
+	formattingTests := []struct {
+		name string
+		src  string
+		op   func(*Kustomizer) error
+		want string
+	}{
+		{
+			"comments, order and indentation are kept",
+			`# The production overlay.
+resources:
+  - ../../base # shared
+images:
+  # Pinned until the migration.
+  - name: redis
+    newTag: 6-alpine # previous
+  - name: example.com/http
+    newTag: v1.0.0
+namespace: production
+`,
+			func(k *Kustomizer) error { return k.AddImageOverride("redis", "6.2-alpine") },
+			`# The production overlay.
+resources:
+  - ../../base # shared
+images:
+  # Pinned until the migration.
+  - name: redis
+    newTag: 6.2-alpine # previous
+  - name: example.com/http
+    newTag: v1.0.0
+namespace: production
+`,
+		},
+		{
+			"new overrides are added after existing overrides",
+			"images:\n- name: redis\n  newTag: \"6\"\n",
+			func(k *Kustomizer) error { return k.AddImageOverride("example.com/http", "1.0") },
+			"images:\n- name: redis\n  newTag: \"6\"\n- name: example.com/http\n  newTag: \"1.0\"\n",
+		},
+		{
+			"images are added to an empty kustomization",
+			"",
+			func(k *Kustomizer) error { return k.SetImageName("redis", "quay.io/mirror/redis") },
+			"images:\n- name: redis\n  newName: quay.io/mirror/redis\n",
+		},
+		{
+			"empty images are written as a block",
+			"namespace: dev\nimages: []\n",
+			func(k *Kustomizer) error { return k.SetImageDigest("redis", testDigest) },
+			"namespace: dev\nimages:\n- name: redis\n  digest: " + testDigest + "\n",
+		},
+		{
+			"null images are replaced with a list",
+			"namespace: dev\nimages:\n",
+			func(k *Kustomizer) error { return k.AddImageOverride("redis", "6-alpine") },
+			"namespace: dev\nimages:\n- name: redis\n  newTag: 6-alpine\n",
+		},
+		{
+			"explicitly null images are replaced with a list",
+			"namespace: dev\nimages: null\n",
+			func(k *Kustomizer) error { return k.AddImageOverride("redis", "6-alpine") },
+			"namespace: dev\nimages:\n- name: redis\n  newTag: 6-alpine\n",
+		},
+		{
+			"removing the last override removes the images",
+			"namespace: dev\nimages:\n- name: redis\n  newTag: 6-alpine\nresources:\n- deployment.yaml\n",
+			func(k *Kustomizer) error { k.RemoveImageOverride("redis"); return nil },
+			"namespace: dev\nresources:\n- deployment.yaml\n",
+		},
+	}
+
+	for _, tt := range formattingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomizer([]byte(tt.src))
+			fatalIfError(t, err)
+
+			fatalIfError(t, tt.op(k))
+
+			b, err := k.YAML()
+			fatalIfError(t, err)
+			if diff := cmp.Diff(tt.want, string(b)); diff != "" {
+				t.Fatalf("YAML didn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseKustomizerWithInvalidKustomization(t *testing.T) {
+	for _, v := range []string{"- name: redis\n", "images: redis\n", "images: [\n"} {
+		if _, err := ParseKustomizer([]byte(v)); err == nil {
+			t.Errorf("ParseKustomizer(%q) didn't fail", v)
+		}
+	}
+}
+
 func createKustomizer() *Kustomizer {
 	k := &types.Kustomization{}
 	return NewKustomizer(k)
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+// The roles of containers within a pod.
+const (
+	RoleInit      = "init"
+	RoleMain      = "main"
+	RoleSidecar   = "sidecar"
+	RoleEphemeral = "ephemeral"
+)
+
+// defaultContainerAnnotation identifies the main container in pods with more
+// than one container.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// Container is a container within a service's pod template.
+//
+// The Role is one of "init", "main", "sidecar" or "ephemeral", init
+// containers that are restarted (native sidecars) are "sidecar", and the main
+// container is the pod's default container, or the first container if it has
+// no default.
+//
+// The ImageName is the image as it's written in the manifest, which Kustomize
+// matches image overrides against, the Image is the normalised reference, or
+// the zero Reference if the ImageName can't be parsed.
+type Container struct {
+	Name      string          `json:"name"`
+	Role      string          `json:"role"`
+	Image     image.Reference `json:"image"`
+	ImageName string          `json:"image_name"`
+	Ports     []Port          `json:"ports,omitempty"`
+	Resources *Resources      `json:"resources,omitempty"`
+	// EnvFrom is the sources of the container's environment variables, e.g.
+	// "configmap/go-demo-config" or "secret/db-password".
+	EnvFrom []string `json:"env_from,omitempty"`
+}
+
+// Port is a port exposed by a container.
+type Port struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int64  `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// Resources are the compute resources requested by a container, the values
+// are Kubernetes quantities, e.g. "100m" or "128Mi".
+type Resources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// extractContainers reads the containers from a pod template, in the order
+// init, regular, and then ephemeral containers.
+//
+// Problems with individual containers are returned as warnings, and the
+// container is skipped, unless only its image can't be parsed, then the
+// container is kept with the image as it's written.
+func extractContainers(f fields, templatePath string) ([]*Container, []error) {
+	defaultContainer := ""
+	if annotations, err := f.sub(templatePath + ".metadata.annotations"); err == nil {
+		defaultContainer, _ = annotations.data[defaultContainerAnnotation].(string)
+	}
+	containers := []*Container{}
+	var warnings []error
+	for _, key := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		path := templatePath + ".spec." + key
+		items, err := f.slice(path)
+		if optional(err) != nil {
+			warnings = append(warnings, err)
+		}
+		for i := range items {
+			c, err := extractContainer(f, fmt.Sprintf("%s.%d", path, i))
+			if err != nil {
+				warnings = append(warnings, err)
+			}
+			if c == nil {
+				continue
+			}
+			switch key {
+			case "initContainers":
+				c.Role = RoleInit
+				if policy, _ := f.string(fmt.Sprintf("%s.%d.restartPolicy", path, i)); policy == "Always" {
+					c.Role = RoleSidecar
+				}
+			case "containers":
+				c.Role = RoleSidecar
+				if c.Name == defaultContainer || (defaultContainer == "" && i == 0) {
+					c.Role = RoleMain
+				}
+			case "ephemeralContainers":
+				c.Role = RoleEphemeral
+			}
+			containers = append(containers, c)
+		}
+	}
+	return containers, warnings
+}
+
+// extractContainer reads a container, if the image can't be parsed, the
+// container is returned with the error.
+func extractContainer(f fields, path string) (*Container, error) {
+	cf, err := f.sub(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Container{}
+	if c.Name, err = f.string(path + ".name"); optional(err) != nil {
+		return nil, err
+	}
+	if c.ImageName, err = f.string(path + ".image"); err != nil {
+		return nil, err
+	}
+	var imageErr error
+	if c.Image, err = image.Parse(c.ImageName); err != nil {
+		imageErr = &PathError{ID: f.id, Path: path + ".image", Err: err}
+	}
+	ports, _ := cf.data["ports"].([]interface{})
+	for i := range ports {
+		p := Port{}
+		portPath := fmt.Sprintf("%s.ports.%d", path, i)
+		if p.ContainerPort, err = f.int64(portPath + ".containerPort"); err != nil {
+			return nil, err
+		}
+		p.Name, _ = f.string(portPath + ".name")
+		p.Protocol, _ = f.string(portPath + ".protocol")
+		c.Ports = append(c.Ports, p)
+	}
+	requests := quantities(cf, "resources.requests")
+	limits := quantities(cf, "resources.limits")
+	if requests != nil || limits != nil {
+		c.Resources = &Resources{Requests: requests, Limits: limits}
+	}
+	c.EnvFrom = envSources(cf)
+	return c, imageErr
+}
+
+// quantities returns the resource quantities at a path, or nil if there are
+// none.
+func quantities(f fields, path string) map[string]string {
+	q, err := f.sub(path)
+	if err != nil || len(q.data) == 0 {
+		return nil
+	}
+	result := map[string]string{}
+	for k, v := range q.data {
+		result[k] = fmt.Sprint(v)
+	}
+	return result
+}
+
+// envSources returns the sorted ConfigMaps and Secrets that a container's
+// environment variables are read from.
+func envSources(f fields) []string {
+	seen := map[string]bool{}
+	add := func(kind string, v interface{}) {
+		if name, err := (fields{data: asMap(v)}).string("name"); err == nil {
+			seen[kind+"/"+name] = true
+		}
+	}
+	envFrom, _ := f.slice("envFrom")
+	for _, v := range envFrom {
+		m := asMap(v)
+		add("configmap", m["configMapRef"])
+		add("secret", m["secretRef"])
+	}
+	env, _ := f.slice("env")
+	for _, v := range env {
+		valueFrom := asMap(asMap(v)["valueFrom"])
+		add("configmap", valueFrom["configMapKeyRef"])
+		add("secret", valueFrom["secretKeyRef"])
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	sources := make([]string, 0, len(seen))
+	for k := range seen {
+		sources = append(sources, k)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// FallbackDirectory is the Labels fallback that uses the name of the
+// directory of the kustomization as the app name.
+const FallbackDirectory = "directory"
+
+// Labels configures how workloads are identified as parts of apps and
+// services.
+//
+// The keys are looked up in the labels of a workload, and then in its
+// annotations, labels added with the kustomization's commonLabels or labels
+// are on the workloads, so they're found in the same way.
+//
+// App defaults to "app.kubernetes.io/part-of", and Service defaults to
+// "app.kubernetes.io/name", if the workload doesn't have the service key, the
+// service name is the name of the workload.
+//
+// Workloads that can't be associated with an app are skipped, unless the
+// Fallback is "directory", then they're part of the FallbackApp, or if that's
+// not set, an app named after the kustomization's directory.
+//
+// The FallbackApp is set for configured apps, whose kustomizations are in the
+// directories of their environments, e.g. "overlays/dev".
+type Labels struct {
+	App         string `json:"app,omitempty"`
+	Service     string `json:"service,omitempty"`
+	Fallback    string `json:"fallback,omitempty"`
+	FallbackApp string `json:"-"`
+}
+
+// Workload identifies a resource that runs pods.
+type Workload struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Validate returns an error if the fallback is unknown.
+func (l Labels) Validate() error {
+	if l.Fallback != "" && l.Fallback != FallbackDirectory {
+		return fmt.Errorf("unknown app fallback %q", l.Fallback)
+	}
+	return nil
+}
+
+func (l Labels) appKey() string {
+	if l.App == "" {
+		return appLabel
+	}
+	return l.App
+}
+
+// appName returns the name of the app that a workload is part of, or "" if
+// it's not part of an app.
+//
+// The dir is the path of the kustomization that's being parsed.
+func (l Labels) appName(dir string, labels, annotations map[string]string) string {
+	if name := lookupKey(l.appKey(), labels, annotations); name != "" {
+		return name
+	}
+	if l.Fallback == FallbackDirectory {
+		if l.FallbackApp != "" {
+			return l.FallbackApp
+		}
+		return directoryName(dir)
+	}
+	return ""
+}
+
+// serviceName returns the name of the service that a workload is part of.
+func (l Labels) serviceName(workload string, labels, annotations map[string]string) string {
+	key := l.Service
+	if key == "" {
+		key = serviceLabel
+	}
+	if name := lookupKey(key, labels, annotations); name != "" {
+		return name
+	}
+	return workload
+}
+
+func lookupKey(key string, labels, annotations map[string]string) string {
+	if v := labels[key]; v != "" {
+		return v
+	}
+	return annotations[key]
+}
+
+// directoryName returns the last element of a path, or "" if the path is the
+// root of a filesystem.
+func directoryName(dir string) string {
+	name := path.Base(filepath.ToSlash(dir))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
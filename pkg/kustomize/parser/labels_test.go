@@ -0,0 +1,61 @@
+package parser
+
+import "testing"
+
+func TestLabelsAppName(t *testing.T) {
+	nameTests := []struct {
+		labels      Labels
+		dir         string
+		lbls        map[string]string
+		annotations map[string]string
+		want        string
+	}{
+		{Labels{}, "base", map[string]string{"app.kubernetes.io/part-of": "go-demo"}, nil, "go-demo"},
+		{Labels{}, "base", nil, map[string]string{"app.kubernetes.io/part-of": "go-demo"}, "go-demo"},
+		{Labels{}, "base", map[string]string{"team": "payments"}, nil, ""},
+		{Labels{App: "team"}, "base", map[string]string{"team": "payments"}, map[string]string{"team": "billing"}, "payments"},
+		{Labels{App: "team", Fallback: FallbackDirectory}, "apps/payments", nil, nil, "payments"},
+		{Labels{Fallback: FallbackDirectory}, ".", nil, nil, ""},
+		{Labels{Fallback: FallbackDirectory}, "/", nil, nil, ""},
+		{Labels{Fallback: FallbackDirectory, FallbackApp: "payments"}, "overlays/dev", nil, nil, "payments"},
+		{Labels{Fallback: FallbackDirectory, FallbackApp: "payments"}, "overlays/dev", map[string]string{"app.kubernetes.io/part-of": "billing"}, nil, "billing"},
+		{Labels{FallbackApp: "payments"}, "overlays/dev", nil, nil, ""},
+	}
+
+	for _, tt := range nameTests {
+		if got := tt.labels.appName(tt.dir, tt.lbls, tt.annotations); got != tt.want {
+			t.Errorf("%#v.appName(%q, %v, %v) got %q, want %q", tt.labels, tt.dir, tt.lbls, tt.annotations, got, tt.want)
+		}
+	}
+}
+
+func TestLabelsValidate(t *testing.T) {
+	for _, l := range []Labels{{}, {App: "team", Fallback: FallbackDirectory}} {
+		if err := l.Validate(); err != nil {
+			t.Errorf("%#v.Validate() failed: %s", l, err)
+		}
+	}
+	if err := (Labels{Fallback: "commonLabels"}).Validate(); err == nil {
+		t.Fatal("expected an error validating an unknown fallback")
+	}
+}
+
+func TestLabelsServiceName(t *testing.T) {
+	nameTests := []struct {
+		labels Labels
+		lbls   map[string]string
+		want   string
+	}{
+		{Labels{}, map[string]string{"app.kubernetes.io/name": "redis"}, "redis"},
+		{Labels{}, nil, "redis-master"},
+		{Labels{Service: "app"}, map[string]string{"app.kubernetes.io/name": "redis"}, "redis-master"},
+		{Labels{Service: "app.kubernetes.io/name"}, map[string]string{"app.kubernetes.io/name": "redis"}, "redis"},
+		{Labels{Service: "app.kubernetes.io/name"}, nil, "redis-master"},
+	}
+
+	for _, tt := range nameTests {
+		if got := tt.labels.serviceName("redis-master", tt.lbls, nil); got != tt.want {
+			t.Errorf("%#v.serviceName(%v) got %q, want %q", tt.labels, tt.lbls, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
-	"sort"
+	"path/filepath"
 
 	"github.com/go-git/go-git/v5"
 	"sigs.k8s.io/kustomize/api/krusty"
@@ -10,6 +11,7 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 
 	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
 )
 
 const (
@@ -17,10 +19,29 @@ const (
 	appLabel     = "app.kubernetes.io/part-of"
 )
 
+// workloads maps the kinds of resource that run pods, to the path of the pod
+// template within them.
+var workloads = map[string]string{
+	"Deployment":  "spec.template",
+	"StatefulSet": "spec.template",
+	"DaemonSet":   "spec.template",
+	"Job":         "spec.template",
+	"CronJob":     "spec.jobTemplate.spec.template",
+	"Rollout":     "spec.template",
+}
+
 // Config is a representation of the apps and services, and configurations for
 // the services.
+//
+// Warnings records problems with individual resources, these resources are
+// skipped or partially parsed, rather than failing the whole parse, the
+// warnings are typically *PathError values.
+//
+// Skipped records the workloads that couldn't be associated with an app.
 type Config struct {
-	Apps []*App
+	Apps     []*App
+	Warnings []error
+	Skipped  []Workload
 }
 
 // App gets the named app from the config, or returns nil if none exist.
@@ -40,21 +61,35 @@ type App struct {
 }
 
 // Service is a representation of a component within the Apps/Services model.
+//
+// A service is made up of the workloads in a namespace with the same service
+// label, these are the Components, workloads without the label are services
+// on their own.
+//
+// Kind is the kind of workload that runs the service, e.g. "Deployment" or
+// "CronJob", this is empty if the components are of different kinds. Replicas
+// is the total of the components' replicas, and is only recorded for
+// workloads that have them.
+//
+// Images are the distinct, normalised images of the long-running main and
+// sidecar containers, the Containers include the init and ephemeral containers
+// too, and the containers with images that can't be parsed.
 type Service struct {
-	Name      string
-	Namespace string
-	Replicas  int64
-	Images    []string
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Replicas   int64             `json:"replicas"`
+	Images     []image.Reference `json:"images"`
+	Containers []*Container      `json:"containers"`
+	Components []*Component      `json:"components"`
 }
 
 // Parse takes a path to a kustomization.yaml file and extracts the service
 // configuration from the built resources.
 //
-// Currently assumes that the standard Kubernetes annotations are used
-// (app.kubernetes.io) to identify apps and services (part-of is the app name,
-// name is the service name)
-//
-// Also multi-Deployment services are not supported currently.
+// This uses the default Labels to identify apps and services
+// (app.kubernetes.io/part-of is the app name, app.kubernetes.io/name is the
+// service name), use ParseConfigWithLabels to identify them differently.
 func Parse(path string) (*Config, error) {
 	fs := filesys.MakeFsOnDisk()
 	return ParseConfig(path, fs)
@@ -70,9 +105,64 @@ func ParseFromGit(path string, opts *git.CloneOptions) (*Config, error) {
 	return ParseConfig(path, gfs)
 }
 
+// ParseFromGitRevision takes a go-git CloneOptions struct, a filepath and a
+// branch, tag or commit, and extracts the service configuration from the files
+// at that revision.
+func ParseFromGitRevision(path string, opts *git.CloneOptions, rev string) (*Config, error) {
+	gfs, err := gitfs.NewInMemoryAtRevision(opts, rev)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(path, gfs)
+}
+
+// ParseAtRevision takes a path to a kustomization.yaml file within a local Git
+// repository, and extracts the service configuration from the files at a
+// branch, tag or commit, without touching the working tree.
+func ParseAtRevision(path, rev string) (*Config, error) {
+	rel, gfs, err := FileSystemAtRevision(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(rel, gfs)
+}
+
+// FileSystemAtRevision takes a path within a local Git repository, and returns
+// the path relative to the root of the repository, and a filesystem with the
+// files at a branch, tag or commit.
+func FileSystemAtRevision(path, rev string) (string, filesys.FileSystem, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := git.PlainOpenWithOptions(abs, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open a Git repository for %s: %w", path, err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return "", nil, err
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), abs)
+	if err != nil {
+		return "", nil, err
+	}
+	gfs, err := gitfs.NewFromRepository(r, rev)
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.ToSlash(rel), gfs, nil
+}
+
 // ParseConfig takes a path and an implementation of the kustomize fs.FileSystem
 // and parses the configuration into apps.
 func ParseConfig(path string, files filesys.FileSystem) (*Config, error) {
+	return ParseConfigWithLabels(path, files, Labels{})
+}
+
+// ParseConfigWithLabels parses the configuration into apps, using the labels
+// to identify the apps and services.
+func ParseConfigWithLabels(path string, files filesys.FileSystem, l Labels) (*Config, error) {
 	cfg := &Config{Apps: []*App{}}
 	resMap, err := ParseTreeToResMap(path, files)
 	if err != nil {
@@ -82,30 +172,40 @@ func ParseConfig(path string, files filesys.FileSystem) (*Config, error) {
 	if resMap.Size() == 0 {
 		return nil, nil
 	}
+	groups := serviceGroups{}
 	for _, k := range resMap.AllIds() {
-		switch k.Gvk.Kind {
-		case "Deployment":
-			r, err := resMap.GetById(k)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get resource %v: %w", k, err)
-			}
-			name := appName(r.GetLabels())
-			if name == "" {
-				continue
-			}
-			app := cfg.App(name)
-			if app == nil {
-				app = &App{Name: name}
-				cfg.Apps = append(cfg.Apps, app)
-			}
-			data, err := r.Map()
-			if err != nil {
-				return nil, fmt.Errorf("failed to get object data: %w", err)
-			}
-			svc := extractService(data)
-			app.Services = append(app.Services, svc)
-			sort.Slice(app.Services, func(i, j int) bool { return app.Services[i].Name < app.Services[j].Name })
+		templatePath, ok := workloads[k.Gvk.Kind]
+		if !ok {
+			continue
+		}
+		r, err := resMap.GetById(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resource %v: %w", k, err)
+		}
+		name := l.appName(path, r.GetLabels(), r.GetAnnotations())
+		if name == "" {
+			cfg.Skipped = append(cfg.Skipped, Workload{Kind: k.Gvk.Kind, Name: k.Name, Namespace: k.Namespace})
+			continue
+		}
+		app := cfg.App(name)
+		if app == nil {
+			app = &App{Name: name}
+			cfg.Apps = append(cfg.Apps, app)
+		}
+		data, err := r.Map()
+		if err != nil {
+			cfg.Warnings = append(cfg.Warnings, fmt.Errorf("%s: failed to get object data: %w", k, err))
+			continue
+		}
+		svc, warnings := extractService(k.Gvk.Kind, templatePath, fields{id: k.String(), data: data})
+		cfg.Warnings = append(cfg.Warnings, warnings...)
+		if svc == nil {
+			continue
 		}
+		groups.add(app, l.serviceName(svc.Name, r.GetLabels(), r.GetAnnotations()), svc)
+	}
+	for _, app := range cfg.Apps {
+		app.Services = groups.services(app)
 	}
 
 	return cfg, nil
@@ -118,43 +218,41 @@ func ParseTreeToResMap(dirPath string, files filesys.FileSystem) (resmap.ResMap,
 	return k.Run(files, dirPath)
 }
 
-func appName(r map[string]string) string {
-	return r[appLabel]
-}
-
-// TODO: write a generic dotted path walker for the map[string]interface{}
-// (again).
-func extractService(v map[string]interface{}) *Service {
-	meta := v["metadata"].(map[string]interface{})
-	spec := v["spec"].(map[string]interface{})
-	templateSpec := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})
-	svc := &Service{
-		Name:      mapString("name", meta),
-		Namespace: mapString("namespace", meta),
-		Replicas:  mapInt64("replicas", spec),
-		Images:    []string{},
-	}
-	for _, v := range templateSpec["containers"].([]interface{}) {
-		svc.Images = append(svc.Images, mapString("image", v.(map[string]interface{})))
-	}
-	return svc
-}
-
-func mapInt64(k string, v map[string]interface{}) int64 {
-	switch i := v[k].(type) {
-	case int:
-		return int64(i)
-	case int64:
-		return i
-	default:
-		return 0
+// extractService reads the service from a workload, the service is nil if it
+// can't be identified, or has no pod template.
+//
+// Problems with the workload are returned as warnings.
+func extractService(kind, templatePath string, f fields) (*Service, []error) {
+	name, err := f.string("metadata.name")
+	if err != nil {
+		return nil, []error{err}
+	}
+	svc := &Service{Name: name, Kind: kind, Images: []image.Reference{}}
+	var warnings []error
+	if svc.Namespace, err = f.string("metadata.namespace"); optional(err) != nil {
+		warnings = append(warnings, err)
+	}
+	if svc.Replicas, err = f.int64("spec.replicas"); optional(err) != nil {
+		warnings = append(warnings, err)
+	}
+	if _, err := f.slice(templatePath + ".spec.containers"); err != nil {
+		return nil, append(warnings, err)
+	}
+	containers, containerWarnings := extractContainers(f, templatePath)
+	warnings = append(warnings, containerWarnings...)
+	svc.Containers = containers
+	for _, c := range containers {
+		if (c.Role == RoleMain || c.Role == RoleSidecar) && !c.Image.IsZero() {
+			svc.Images = append(svc.Images, c.Image)
+		}
 	}
+	return svc, warnings
 }
 
-func mapString(k string, v map[string]interface{}) string {
-	s, ok := v[k].(string)
-	if !ok {
-		return ""
+// optional ignores the error for fields that don't need to be set.
+func optional(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return nil
 	}
-	return s
+	return err
 }
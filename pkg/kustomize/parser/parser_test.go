@@ -1,11 +1,19 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/image"
 )
 
 func TestParseNoFile(t *testing.T) {
@@ -33,8 +41,8 @@ func TestParseApplication(t *testing.T) {
 					{
 						Name: "go-demo",
 						Services: []*Service{
-							{Name: "go-demo-http", Replicas: 1, Images: []string{"bigkevmcd/go-demo:876ecb3"}},
-							{Name: "redis", Replicas: 1, Images: []string{"redis:6-alpine"}},
+							goDemoService("", "bigkevmcd/go-demo:876ecb3"),
+							redisService(""),
 						},
 					},
 				},
@@ -48,7 +56,7 @@ func TestParseApplication(t *testing.T) {
 					{
 						Name: "taxi",
 						Services: []*Service{
-							{Name: "taxi", Replicas: 1, Images: []string{"quay.io/kmcdermo/taxi:147036"}},
+							{Name: "taxi", Kind: "Deployment", Replicas: 1, Images: images("quay.io/kmcdermo/taxi:147036")},
 						},
 					},
 				},
@@ -62,7 +70,7 @@ func TestParseApplication(t *testing.T) {
 					{
 						Name: "taxi",
 						Services: []*Service{
-							{Name: "taxi", Replicas: 5, Images: []string{"quay.io/kmcdermo/taxi:master"}},
+							{Name: "taxi", Kind: "Deployment", Replicas: 5, Images: images("quay.io/kmcdermo/taxi:master")},
 						},
 					},
 				},
@@ -76,7 +84,9 @@ func TestParseApplication(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			if diff := cmp.Diff(tt.want, app); diff != "" {
+			// The containers and components in the remote apps aren't
+			// pinned, the images identify the versions.
+			if diff := cmp.Diff(tt.want, app, cmpopts.IgnoreFields(Service{}, "Containers", "Components")); diff != "" {
 				t.Errorf("%s failed to parse:\n%s", tt.filename, diff)
 			}
 		})
@@ -99,8 +109,8 @@ func TestParseApplicationFromGit(t *testing.T) {
 			{
 				Name: "go-demo",
 				Services: []*Service{
-					{Name: "go-demo-http", Replicas: 1, Images: []string{"bigkevmcd/go-demo:876ecb3"}},
-					{Name: "redis", Replicas: 1, Images: []string{"redis:6-alpine"}},
+					goDemoService("", "bigkevmcd/go-demo:876ecb3"),
+					redisService(""),
 				},
 			},
 		},
@@ -108,15 +118,128 @@ func TestParseApplicationFromGit(t *testing.T) {
 	assertCmp(t, want, app, "failed to match app")
 }
 
-func TestAppName(t *testing.T) {
-	redis := map[string]string{"app.kubernetes.io/name": "redis", "app.kubernetes.io/part-of": "go-demo"}
-	name := appName(redis)
+func TestParseApplicationFromGitRevision(t *testing.T) {
+	app, err := ParseFromGitRevision(
+		"pkg/kustomize/parser/testdata/go-demo",
+		&git.CloneOptions{
+			URL: "../../..",
+		}, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Apps: []*App{
+			{
+				Name: "go-demo",
+				Services: []*Service{
+					goDemoService("", "bigkevmcd/go-demo:876ecb3"),
+					redisService(""),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, app, "failed to match app")
+}
+
+func TestParseAtRevision(t *testing.T) {
+	app, err := ParseAtRevision("testdata/go-demo", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Apps: []*App{
+			{
+				Name: "go-demo",
+				Services: []*Service{
+					goDemoService("", "bigkevmcd/go-demo:876ecb3"),
+					redisService(""),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, app, "failed to match app")
+}
 
-	if name != "go-demo" {
-		t.Fatalf("got %#v, want %#v", name, "go-demo")
+func TestParseAtRevisionOutsideRepository(t *testing.T) {
+	_, err := ParseAtRevision(t.TempDir(), "HEAD")
+	if err == nil {
+		t.Fatal("expected an error parsing outside of a Git repository")
 	}
 }
 
+func TestParseFromGitMatchesDisk(t *testing.T) {
+	gfs, err := gitfs.NewInMemoryFromOptions(
+		&git.CloneOptions{
+			URL:   "../../..",
+			Depth: 1,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		"pkg/kustomize/parser/testdata/go-demo",
+		"pkg/config/testdata/go-demo/overlays/dev",
+		"pkg/config/testdata/go-demo/overlays/staging",
+		"pkg/config/testdata/go-demo/overlays/production",
+	}
+	for _, p := range paths {
+		t.Run(p, func(t *testing.T) {
+			fromDisk, err := ParseConfig(filepath.Join("../../..", p), filesys.MakeFsOnDisk())
+			if err != nil {
+				t.Fatal(err)
+			}
+			fromGit, err := ParseConfig(p, gfs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertCmp(t, fromDisk, fromGit, "parsing from Git didn't match the disk")
+		})
+	}
+}
+
+func TestParseConfigWithOverlay(t *testing.T) {
+	gfs, err := gitfs.NewInMemoryFromOptions(
+		&git.CloneOptions{
+			URL:   "../../..",
+			Depth: 1,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := gitfs.NewOverlay(gfs)
+	err = overlay.WriteFile("pkg/config/testdata/go-demo/overlays/dev/kustomization.yaml", []byte(`resources:
+- ../../base
+namespace: dev
+images:
+- name: bigkevmcd/go-demo
+  newTag: v1.2.3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseConfig("pkg/config/testdata/go-demo/overlays/dev", overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Apps: []*App{
+			{
+				Name: "go-demo",
+				Services: []*Service{
+					goDemoService("dev", "bigkevmcd/go-demo:v1.2.3"),
+					redisService("dev"),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, cfg, "failed to parse the modified overlay")
+}
+
 func TestExtractService(t *testing.T) {
 	redisMap := map[string]interface{}{
 		"apiVersion": "apps/v1",
@@ -149,16 +272,303 @@ func TestExtractService(t *testing.T) {
 		},
 	}
 
-	svc := extractService(redisMap)
+	svc, warnings := extractService("Deployment", workloads["Deployment"], fields{id: "redis", data: redisMap})
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
 	want := &Service{
 		Name:      "redis",
+		Kind:      "Deployment",
 		Namespace: "test-env",
 		Replicas:  1,
-		Images:    []string{"redis:6-alpine"},
+		Images:    images("redis:6-alpine"),
+		Containers: []*Container{
+			{Name: "redis", Role: RoleMain, Image: image.MustParse("redis:6-alpine"), ImageName: "redis:6-alpine", Ports: []Port{{ContainerPort: 6379}}},
+		},
 	}
 	assertCmp(t, want, svc, "failed to match service")
 }
 
+func TestParseWorkloads(t *testing.T) {
+	cfg, err := Parse("testdata/workloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Apps: []*App{
+			{
+				Name: "workloads",
+				Services: []*Service{
+					workload("backup", "CronJob", 0, "backup", "example.com/backup:v1.2.0"),
+					workload("frontend", "Rollout", 5, "frontend", "example.com/frontend:v2.0.0"),
+					workload("log-agent", "DaemonSet", 0, "fluent-bit", "fluent/fluent-bit:1.8"),
+					workload("migrate", "Job", 0, "migrate", "example.com/migrate:v1.2.0"),
+					workload("postgres", "StatefulSet", 3, "postgres", "postgres:13"),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, cfg, "failed to parse workloads")
+}
+
+func TestParseWithInvalidWorkloads(t *testing.T) {
+	cfg, err := Parse("testdata/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Service{
+		{
+			Name:   "bad-fields",
+			Kind:   "Deployment",
+			Images: images("example.com/http:v1.0.0"),
+			// The invalid first container would have been the main container.
+			Containers: []*Container{
+				{Name: "http", Role: RoleSidecar, Image: image.MustParse("example.com/http:v1.0.0"), ImageName: "example.com/http:v1.0.0"},
+				{Name: "invalid", Role: RoleSidecar, ImageName: "example.com/HTTP:v1.0.0"},
+			},
+			Components: []*Component{{Kind: "Deployment", Name: "bad-fields", Images: images("example.com/http:v1.0.0")}},
+		},
+		{
+			Name:       "working",
+			Kind:       "Deployment",
+			Replicas:   2,
+			Images:     images("example.com/http:v1.0.0"),
+			Containers: []*Container{{Name: "http", Role: RoleMain, Image: image.MustParse("example.com/http:v1.0.0"), ImageName: "example.com/http:v1.0.0"}},
+			Components: []*Component{{Kind: "Deployment", Name: "working", Replicas: 2, Images: images("example.com/http:v1.0.0")}},
+		},
+	}
+	assertCmp(t, want, cfg.App("broken").Services, "failed to parse services")
+
+	warnings := []string{}
+	for _, w := range cfg.Warnings {
+		var pathErr *PathError
+		if !errors.As(w, &pathErr) {
+			t.Fatalf("got %#v, want a *PathError", w)
+		}
+		warnings = append(warnings, pathErr.Path)
+	}
+	wantWarnings := []string{
+		"spec.template.spec.containers",
+		"spec.replicas",
+		"spec.template.spec.containers.0.image",
+		"spec.template.spec.containers.2.image",
+	}
+	assertCmp(t, wantWarnings, warnings, "failed to record warnings")
+	if msg := cfg.Warnings[0].Error(); !strings.Contains(msg, "no-template") {
+		t.Fatalf("warning didn't identify the resource: %s", msg)
+	}
+}
+
+func TestParseContainers(t *testing.T) {
+	cfg, err := Parse("testdata/containers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Service{
+		{
+			Name:     "api",
+			Kind:     "Deployment",
+			Replicas: 2,
+			Images:   images("example.com/proxy:v2.1.0", "example.com/log-shipper:v0.3.0", "example.com/api:v1.0.0"),
+			Containers: []*Container{
+				{Name: "migrate", Role: RoleInit, Image: image.MustParse("example.com/migrate:v1.0.0"), ImageName: "example.com/migrate:v1.0.0", EnvFrom: []string{"secret/db-credentials"}},
+				{Name: "proxy", Role: RoleSidecar, Image: image.MustParse("example.com/proxy:v2.1.0"), ImageName: "example.com/proxy:v2.1.0"},
+				{Name: "log-shipper", Role: RoleSidecar, Image: image.MustParse("example.com/log-shipper:v0.3.0"), ImageName: "example.com/log-shipper:v0.3.0"},
+				{
+					Name:      "api",
+					Role:      RoleMain,
+					Image:     image.MustParse("example.com/api:v1.0.0"),
+					ImageName: "example.com/api:v1.0.0",
+					Ports:     []Port{{Name: "http", ContainerPort: 8080, Protocol: "TCP"}},
+					Resources: &Resources{
+						Requests: map[string]string{"cpu": "250m", "memory": "128Mi"},
+						Limits:   map[string]string{"memory": "256Mi"},
+					},
+					EnvFrom: []string{"configmap/api-config", "secret/db-credentials"},
+				},
+				{Name: "debugger", Role: RoleEphemeral, Image: image.MustParse("busybox:1.36"), ImageName: "busybox:1.36"},
+			},
+			Components: []*Component{
+				{
+					Kind:     "Deployment",
+					Name:     "api",
+					Replicas: 2,
+					Images:   images("example.com/proxy:v2.1.0", "example.com/log-shipper:v0.3.0", "example.com/api:v1.0.0"),
+				},
+			},
+		},
+	}
+	assertCmp(t, want, cfg.App("containers").Services, "failed to parse containers")
+	if len(cfg.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", cfg.Warnings)
+	}
+}
+
+func TestParseWithLabels(t *testing.T) {
+	labelTests := []struct {
+		name        string
+		labels      Labels
+		wantApps    map[string][]string
+		wantSkipped []Workload
+	}{
+		{
+			"default labels",
+			Labels{},
+			map[string][]string{},
+			[]Workload{
+				{Kind: "Deployment", Name: "payments-api", Namespace: "labels"},
+				{Kind: "Deployment", Name: "payments-worker", Namespace: "labels"},
+				{Kind: "Deployment", Name: "unowned", Namespace: "labels"},
+			},
+		},
+		{
+			"app and service keys",
+			Labels{App: "team", Service: "app"},
+			map[string][]string{"payments": {"api", "payments-worker"}},
+			[]Workload{{Kind: "Deployment", Name: "unowned", Namespace: "labels"}},
+		},
+		{
+			"directory fallback",
+			Labels{App: "team", Fallback: FallbackDirectory},
+			map[string][]string{"labels": {"unowned"}, "payments": {"payments-api", "payments-worker"}},
+			nil,
+		},
+	}
+
+	for _, tt := range labelTests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfigWithLabels("testdata/labels", filesys.MakeFsOnDisk(), tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			apps := map[string][]string{}
+			for _, app := range cfg.Apps {
+				for _, svc := range app.Services {
+					apps[app.Name] = append(apps[app.Name], svc.Name)
+				}
+			}
+			assertCmp(t, tt.wantApps, apps, "failed to identify apps")
+			assertCmp(t, tt.wantSkipped, cfg.Skipped, "failed to report skipped workloads")
+		})
+	}
+}
+
+func TestParseGroupsServices(t *testing.T) {
+	cfg, err := Parse("testdata/grouped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Service{
+		{
+			Name:      "orders",
+			Kind:      "Deployment",
+			Namespace: "orders",
+			Replicas:  5,
+			Images:    images("example.com/orders:v1.4.0", "example.com/metrics-exporter:v0.2.0"),
+			Containers: []*Container{
+				{Name: "api", Role: RoleMain, Image: image.MustParse("example.com/orders:v1.4.0"), ImageName: "example.com/orders:v1.4.0"},
+				{Name: "worker", Role: RoleMain, Image: image.MustParse("example.com/orders:v1.4.0"), ImageName: "example.com/orders:v1.4.0"},
+				{Name: "metrics", Role: RoleSidecar, Image: image.MustParse("example.com/metrics-exporter:v0.2.0"), ImageName: "example.com/metrics-exporter:v0.2.0"},
+			},
+			Components: []*Component{
+				{Kind: "Deployment", Name: "orders-api", Replicas: 3, Images: images("example.com/orders:v1.4.0")},
+				{Kind: "Deployment", Name: "orders-worker", Replicas: 2, Images: images("example.com/orders:v1.4.0", "example.com/metrics-exporter:v0.2.0")},
+			},
+		},
+		{
+			Name:       "redis",
+			Kind:       "Deployment",
+			Namespace:  "orders",
+			Replicas:   1,
+			Images:     images("redis:6-alpine"),
+			Containers: []*Container{{Name: "redis", Role: RoleMain, Image: image.MustParse("redis:6-alpine"), ImageName: "redis:6-alpine"}},
+			Components: []*Component{{Kind: "Deployment", Name: "redis", Replicas: 1, Images: images("redis:6-alpine")}},
+		},
+		{
+			Name:      "reports",
+			Namespace: "orders",
+			Images:    images("example.com/reports:v1.0.0"),
+			Containers: []*Container{
+				{Name: "reports", Role: RoleMain, Image: image.MustParse("example.com/reports:v1.0.0"), ImageName: "example.com/reports:v1.0.0"},
+				{Name: "reports", Role: RoleMain, Image: image.MustParse("example.com/reports:v1.0.0"), ImageName: "example.com/reports:v1.0.0"},
+			},
+			Components: []*Component{
+				{Kind: "CronJob", Name: "reports", Images: images("example.com/reports:v1.0.0")},
+				{Kind: "Job", Name: "reports-backfill", Images: images("example.com/reports:v1.0.0")},
+			},
+		},
+	}
+	assertCmp(t, want, cfg.App("orders").Services, "failed to group services")
+}
+
+// workload returns a service in the workloads testdata with a single
+// container.
+func workload(name, kind string, replicas int64, container, ref string) *Service {
+	return &Service{
+		Name:       name,
+		Kind:       kind,
+		Namespace:  "workloads",
+		Replicas:   replicas,
+		Images:     images(ref),
+		Containers: []*Container{{Name: container, Role: RoleMain, Image: image.MustParse(ref), ImageName: ref}},
+		Components: []*Component{{Kind: kind, Name: name, Replicas: replicas, Images: images(ref)}},
+	}
+}
+
+func goDemoService(namespace, ref string) *Service {
+	return &Service{
+		Name:       "go-demo",
+		Kind:       "Deployment",
+		Namespace:  namespace,
+		Replicas:   1,
+		Images:     images(ref),
+		Components: []*Component{{Kind: "Deployment", Name: "go-demo-http", Replicas: 1, Images: images(ref)}},
+		Containers: []*Container{
+			{
+				Name:      "http",
+				Role:      RoleMain,
+				Image:     image.MustParse(ref),
+				ImageName: ref,
+				Ports:     []Port{{ContainerPort: 8080}},
+				EnvFrom:   []string{"configmap/go-demo-config"},
+			},
+		},
+	}
+}
+
+func redisService(namespace string) *Service {
+	return &Service{
+		Name:       "redis",
+		Kind:       "Deployment",
+		Namespace:  namespace,
+		Replicas:   1,
+		Images:     images("redis:6-alpine"),
+		Components: []*Component{{Kind: "Deployment", Name: "redis", Replicas: 1, Images: images("redis:6-alpine")}},
+		Containers: []*Container{
+			{
+				Name:      "redis",
+				Role:      RoleMain,
+				Image:     image.MustParse("redis:6-alpine"),
+				ImageName: "redis:6-alpine",
+				Ports:     []Port{{ContainerPort: 6379}},
+				Resources: &Resources{Requests: map[string]string{"cpu": "100m", "memory": "100Mi"}},
+			},
+		},
+	}
+}
+
+func images(refs ...string) []image.Reference {
+	parsed := make([]image.Reference, len(refs))
+	for i, v := range refs {
+		parsed[i] = image.MustParse(v)
+	}
+	return parsed
+}
+
 func assertCmp(t *testing.T, want, got interface{}, msg string) {
 	t.Helper()
 	if diff := cmp.Diff(want, got); diff != "" {
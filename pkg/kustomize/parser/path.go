@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when there is no value at a path.
+var ErrNotFound = errors.New("not found")
+
+// TypeError is returned when the value at a path isn't of the expected type.
+type TypeError struct {
+	Want string
+	Got  interface{}
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("expected %s, got %T", e.Want, e.Got)
+}
+
+// PathError records a failure to read the value at a dotted path within a
+// resource, Err is ErrNotFound, a *TypeError, or the error parsing the value.
+type PathError struct {
+	ID   string // The ID of the resource, this is empty for unidentified values.
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("failed to read %s: %s", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s: failed to read %s: %s", e.ID, e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Lookup walks a dotted path, e.g. "spec.template.spec" through nested maps,
+// the elements of slices are addressed by index, e.g. "containers.0.image".
+//
+// The error is a *PathError if there's no value at the path, or if the path
+// goes through a value that's not a map or slice.
+func Lookup(v interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+	for _, k := range strings.Split(path, ".") {
+		switch current := v.(type) {
+		case map[string]interface{}:
+			next, ok := current[k]
+			if !ok || next == nil {
+				return nil, &PathError{Path: path, Err: ErrNotFound}
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(current) {
+				return nil, &PathError{Path: path, Err: ErrNotFound}
+			}
+			v = current[i]
+		default:
+			return nil, &PathError{Path: path, Err: &TypeError{Want: "map or slice", Got: v}}
+		}
+	}
+	return v, nil
+}
+
+// fields reads typed values from a resource, the errors identify the
+// resource.
+type fields struct {
+	id   string
+	data map[string]interface{}
+}
+
+func (f fields) lookup(path string) (interface{}, error) {
+	v, err := Lookup(f.data, path)
+	if err != nil {
+		err.(*PathError).ID = f.id
+		return nil, err
+	}
+	return v, nil
+}
+
+func (f fields) typeError(path, want string, got interface{}) error {
+	return &PathError{ID: f.id, Path: path, Err: &TypeError{Want: want, Got: got}}
+}
+
+func (f fields) sub(path string) (fields, error) {
+	v, err := f.lookup(path)
+	if err != nil {
+		return fields{}, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return fields{}, f.typeError(path, "map", v)
+	}
+	return fields{id: f.id, data: m}, nil
+}
+
+func (f fields) slice(path string) ([]interface{}, error) {
+	v, err := f.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.([]interface{})
+	if !ok {
+		return nil, f.typeError(path, "slice", v)
+	}
+	return s, nil
+}
+
+func (f fields) string(path string) (string, error) {
+	v, err := f.lookup(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", f.typeError(path, "string", v)
+	}
+	return s, nil
+}
+
+func (f fields) int64(path string) (int64, error) {
+	v, err := f.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+	switch i := v.(type) {
+	case int:
+		return int64(i), nil
+	case int64:
+		return i, nil
+	case float64:
+		if i == float64(int64(i)) {
+			return int64(i), nil
+		}
+	}
+	return 0, f.typeError(path, "integer", v)
+}
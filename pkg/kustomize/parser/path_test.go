@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	v := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": 3,
+			"containers": []interface{}{
+				map[string]interface{}{"image": "redis:6-alpine"},
+			},
+		},
+	}
+
+	lookupTests := []struct {
+		path string
+		want interface{}
+	}{
+		{"spec.replicas", 3},
+		{"spec.containers.0.image", "redis:6-alpine"},
+		{"", v},
+	}
+
+	for _, tt := range lookupTests {
+		got, err := Lookup(v, tt.path)
+		if err != nil {
+			t.Errorf("Lookup(%q) failed: %s", tt.path, err)
+			continue
+		}
+		assertCmp(t, tt.want, got, "failed to lookup "+tt.path)
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	v := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "redis", "namespace": nil},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{"redis:6-alpine"},
+		},
+	}
+
+	errorTests := []struct {
+		path     string
+		notFound bool
+	}{
+		{"spec.template", true},
+		{"metadata.namespace", true},
+		{"spec.containers.1", true},
+		{"spec.containers.first", true},
+		{"metadata.name.first", false},
+		{"spec.containers.0.image", false},
+	}
+
+	for _, tt := range errorTests {
+		_, err := Lookup(v, tt.path)
+		var pathErr *PathError
+		if !errors.As(err, &pathErr) {
+			t.Errorf("Lookup(%q) got %v, want a *PathError", tt.path, err)
+			continue
+		}
+		if pathErr.Path != tt.path {
+			t.Errorf("Lookup(%q) got path %q", tt.path, pathErr.Path)
+		}
+		var typeErr *TypeError
+		if tt.notFound != errors.Is(err, ErrNotFound) || tt.notFound == errors.As(err, &typeErr) {
+			t.Errorf("Lookup(%q) got %v", tt.path, err)
+		}
+	}
+}
+
+func TestFieldsErrorsIdentifyTheResource(t *testing.T) {
+	f := fields{
+		id:   "Deployment.v1.apps/redis.dev",
+		data: map[string]interface{}{"spec": map[string]interface{}{"replicas": "lots"}},
+	}
+
+	_, err := f.int64("spec.replicas")
+
+	want := "Deployment.v1.apps/redis.dev: failed to read spec.replicas: expected integer, got string"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %s", err, want)
+	}
+	if _, err := f.string("metadata.name"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"sort"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+// Component is one of the workloads that make up a service, with its own
+// replicas and images.
+type Component struct {
+	Kind     string            `json:"kind"`
+	Name     string            `json:"name"`
+	Replicas int64             `json:"replicas"`
+	Images   []image.Reference `json:"images"`
+}
+
+type serviceKey struct {
+	name      string
+	namespace string
+}
+
+// serviceGroups collects the workloads that make up each app's services.
+type serviceGroups map[*App]map[serviceKey][]*Service
+
+// add records a workload, parsed as a single service, as part of the named
+// service.
+func (g serviceGroups) add(app *App, name string, workload *Service) {
+	if g[app] == nil {
+		g[app] = map[serviceKey][]*Service{}
+	}
+	key := serviceKey{name: name, namespace: workload.Namespace}
+	g[app][key] = append(g[app][key], workload)
+}
+
+// services returns the app's services ordered by name and namespace, or nil
+// if it has none.
+func (g serviceGroups) services(app *App) []*Service {
+	if len(g[app]) == 0 {
+		return nil
+	}
+	services := make([]*Service, 0, len(g[app]))
+	for k, v := range g[app] {
+		services = append(services, groupService(k.name, v))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].Namespace < services[j].Namespace
+	})
+	return services
+}
+
+// groupService combines workloads into a single named service.
+//
+// The Replicas is the total of the workloads' replicas, the Images are the
+// distinct images of the workloads, and the Kind is only set if all the
+// workloads are of the same kind.
+func groupService(name string, workloads []*Service) *Service {
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Name != workloads[j].Name {
+			return workloads[i].Name < workloads[j].Name
+		}
+		return workloads[i].Kind < workloads[j].Kind
+	})
+	svc := &Service{
+		Name:       name,
+		Kind:       workloads[0].Kind,
+		Namespace:  workloads[0].Namespace,
+		Images:     []image.Reference{},
+		Containers: []*Container{},
+		Components: []*Component{},
+	}
+	seen := map[image.Reference]bool{}
+	for _, w := range workloads {
+		if w.Kind != svc.Kind {
+			svc.Kind = ""
+		}
+		svc.Replicas += w.Replicas
+		for _, ref := range w.Images {
+			if !seen[ref] {
+				seen[ref] = true
+				svc.Images = append(svc.Images, ref)
+			}
+		}
+		svc.Containers = append(svc.Containers, w.Containers...)
+		svc.Components = append(svc.Components, &Component{Kind: w.Kind, Name: w.Name, Replicas: w.Replicas, Images: w.Images})
+	}
+	return svc
+}
@@ -0,0 +1,146 @@
+// Package promote copies the images of a service from one environment of an
+// app to another.
+package promote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/image"
+	"github.com/bigkevmcd/peanut/pkg/kustomize"
+)
+
+// Promotion is the result of promoting a service's images.
+//
+// Images are the image overrides written to the target environment's
+// kustomization at Path, From is the image currently in the target
+// environment, and To is the image from the source environment.
+type Promotion struct {
+	App     string                `json:"app"`
+	Service string                `json:"service"`
+	From    string                `json:"from"`
+	To      string                `json:"to"`
+	Path    string                `json:"path"`
+	Images  []*config.ImageChange `json:"images"`
+}
+
+// Promote reads the images of a service that are rendered in the "from"
+// environment, and writes image overrides to the kustomization of the "to"
+// environment, so that it renders the same images.
+//
+// Images are matched by name, images that are only in one of the
+// environments are not promoted, and images that are identified by a digest
+// without a tag can't be promoted. The "to" environment is rendered after the
+// overrides are written, and it's an error if it doesn't render the promoted
+// images.
+//
+// The files are usually a gitfs.Overlay, so that the changes can be reviewed
+// before they're written.
+func Promote(app *config.App, files filesys.FileSystem, service, from, to string) (*Promotion, error) {
+	for _, name := range []string{from, to} {
+		if app.Environment(name) == nil {
+			return nil, fmt.Errorf("unknown environment %q in app %s", name, app.Name)
+		}
+	}
+	target := app.Environment(to)
+	desired, err := config.ParseManifestsFromFileSystem(app, files, plumbing.ZeroHash)
+	if err != nil {
+		return nil, err
+	}
+	state := desired.App(app.Name)
+	if state == nil {
+		return nil, fmt.Errorf("no services found for app %s", app.Name)
+	}
+	for _, name := range []string{from, to} {
+		if !hasService(state.Environment(name), service) {
+			return nil, fmt.Errorf("service %s isn't in environment %s of app %s", service, name, app.Name)
+		}
+	}
+	diff, err := config.DiffEnvironments(state, to, from)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, kz, err := kustomize.ReadKustomization(files, target.Path())
+	if err != nil {
+		return nil, err
+	}
+	p := &Promotion{App: app.Name, Service: service, From: from, To: to, Path: filename, Images: []*config.ImageChange{}}
+	k := kz.Kustomization()
+	for _, d := range diff.Services {
+		if d.Name != service {
+			continue
+		}
+		for _, c := range d.Images {
+			if c.From == nil || c.To == nil {
+				continue
+			}
+			if c.To.Tag == "" {
+				return nil, fmt.Errorf("can't promote %s, only tagged images can be promoted", c.To)
+			}
+			rendered := renderedImageName(state.Environment(to), service, *c.From)
+			if err := kz.AddImageOverride(kustomize.OverrideName(k, rendered), c.To.Tag); err != nil {
+				return nil, err
+			}
+			p.Images = append(p.Images, c)
+		}
+	}
+	if len(p.Images) == 0 {
+		return p, nil
+	}
+
+	if err := kustomize.WriteKustomization(files, filename, kz); err != nil {
+		return nil, err
+	}
+	promoted := make([]image.Reference, len(p.Images))
+	for i, c := range p.Images {
+		promoted[i] = *c.To
+	}
+	if err := kustomize.CheckImages(files, target.Path(), promoted...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Message returns a commit message that lists the promoted images.
+func (p *Promotion) Message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Promote %s from %s to %s\n\n", p.Service, p.From, p.To)
+	fmt.Fprintf(&b, "Updates the images of %s in the %s environment of %s:\n\n", p.Service, p.To, p.App)
+	for _, c := range p.Images {
+		fmt.Fprintf(&b, "- %s -> %s\n", c.From.Familiar(), c.To.Familiar())
+	}
+	return b.String()
+}
+
+// renderedImageName returns an image of a service as it's written in the
+// rendered manifests of an environment.
+func renderedImageName(env *config.EnvironmentState, service string, ref image.Reference) string {
+	for _, svc := range env.Services {
+		if svc.Name != service {
+			continue
+		}
+		for _, c := range svc.Containers {
+			if c.Image == ref {
+				return c.ImageName
+			}
+		}
+	}
+	return ref.String()
+}
+
+func hasService(env *config.EnvironmentState, name string) bool {
+	if env == nil {
+		return false
+	}
+	for _, v := range env.Services {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
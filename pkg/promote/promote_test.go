@@ -0,0 +1,160 @@
+package promote
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/config"
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+	"github.com/bigkevmcd/peanut/pkg/internal/demotest"
+)
+
+func TestPromote(t *testing.T) {
+	tests := []struct {
+		service       string
+		want          []*config.ImageChange
+		kustomization string
+	}{
+		{
+			service: "http",
+			want:    []*config.ImageChange{demotest.ImageChange("example.com/http", "example.com/http:v1.0.0", "example.com/http:v1.1.0")},
+			kustomization: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: production
+resources:
+- ../../base
+images:
+- name: example.com/http
+  newName: example.com/http
+  newTag: v1.1.0
+`,
+		},
+		{
+			service: "redis",
+			want:    []*config.ImageChange{demotest.ImageChange("docker.io/library/redis", "redis:6-alpine", "redis:6.2-alpine")},
+			kustomization: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: production
+resources:
+- ../../base
+images:
+- name: example.com/http
+  newName: example.com/http
+  newTag: v1.0.0
+- name: redis
+  newTag: 6.2-alpine
+`,
+		},
+		{
+			service: "worker",
+			want:    []*config.ImageChange{demotest.ImageChange("docker.io/library/busybox", "busybox:1.36", "busybox:1.37")},
+			kustomization: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: production
+resources:
+- ../../base
+images:
+- name: example.com/http
+  newName: example.com/http
+  newTag: v1.0.0
+- name: docker.io/library/busybox
+  newTag: "1.37"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			files := demotest.Files()
+
+			p, err := Promote(demotest.App(), files, tt.service, "staging", "production")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := &Promotion{
+				App:     "demo",
+				Service: tt.service,
+				From:    "staging",
+				To:      "production",
+				Path:    "demo/overlays/production/kustomization.yaml",
+				Images:  tt.want,
+			}
+			if diff := cmp.Diff(want, p); diff != "" {
+				t.Fatalf("failed to promote:\n%s", diff)
+			}
+			changes, err := files.Changes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantChanges := []gitfs.Change{{Path: want.Path, Contents: []byte(tt.kustomization)}}
+			if diff := cmp.Diff(wantChanges, changes); diff != "" {
+				t.Fatalf("failed to write the kustomization:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPromoteWithNoChanges(t *testing.T) {
+	files := demotest.Files()
+
+	p, err := Promote(demotest.App(), files, "http", "production", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(p.Images); l != 0 {
+		t.Fatalf("got %d promoted images, want 0", l)
+	}
+	changes, err := files.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(changes); l != 0 {
+		t.Fatalf("got %d changes, want 0", l)
+	}
+}
+
+func TestPromoteErrors(t *testing.T) {
+	tests := []struct {
+		service, from, to string
+		wantErr           string
+	}{
+		{"http", "staging", "unknown", `unknown environment "unknown" in app demo`},
+		{"unknown", "staging", "production", "service unknown isn't in environment staging of app demo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := Promote(demotest.App(), demotest.Files(), tt.service, tt.from, tt.to)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromotionMessage(t *testing.T) {
+	p := &Promotion{
+		App:     "demo",
+		Service: "http",
+		From:    "staging",
+		To:      "production",
+		Images: []*config.ImageChange{
+			demotest.ImageChange("example.com/http", "example.com/http:v1.0.0", "example.com/http:v1.1.0"),
+			demotest.ImageChange("docker.io/library/redis", "redis:6-alpine", "redis:6.2-alpine"),
+		},
+	}
+
+	want := `Promote http from staging to production
+
+Updates the images of http in the production environment of demo:
+
+- example.com/http:v1.0.0 -> example.com/http:v1.1.0
+- redis:6-alpine -> redis:6.2-alpine
+`
+	if diff := cmp.Diff(want, p.Message()); diff != "" {
+		t.Fatalf("incorrect message:\n%s", diff)
+	}
+}
@@ -0,0 +1,293 @@
+// Package registry reads the tags of images from registries that implement
+// the OCI distribution API, and selects tags with policies.
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+// dockerHubAPI is the host of the Docker Hub registry API, images in the
+// "docker.io" registry are read from it.
+const dockerHubAPI = "registry-1.docker.io"
+
+// The media types of the manifests that are accepted, image indexes are
+// resolved to the manifest for linux/amd64, or the first manifest.
+var manifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+var nextLinkRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Client reads from registries with the OCI distribution API.
+//
+// Anonymous access is used unless a Username is provided, registries that
+// require bearer tokens are supported.
+type Client struct {
+	Username string
+	Password string
+	// PlainHTTP connects to registries without TLS, for local registries.
+	PlainHTTP bool
+
+	client *http.Client
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// New creates and returns a new Client, the client defaults to
+// http.DefaultClient.
+func New(client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{client: client, tokens: map[string]string{}}
+}
+
+// Tags returns the tags of an image's repository, the image's tag and digest
+// are ignored.
+func (c *Client) Tags(ctx context.Context, ref image.Reference) ([]string, error) {
+	var tags []string
+	next := c.url(ref, "/tags/list")
+	for next != "" {
+		var result struct {
+			Tags []string `json:"tags"`
+		}
+		res, err := c.get(ctx, ref, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the tags of %s: %w", ref.Name(), err)
+		}
+		tags = append(tags, result.Tags...)
+		next, err = nextLink(next, res.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// Created returns the time that an image was created, from the image's
+// configuration.
+func (c *Client) Created(ctx context.Context, ref image.Reference) (time.Time, error) {
+	manifestRef := ref.Digest
+	if manifestRef == "" {
+		manifestRef = ref.Tag
+	}
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := c.getJSON(ctx, ref, c.url(ref, "/manifests/"+manifestRef), manifestTypes, &manifest); err != nil {
+		return time.Time{}, err
+	}
+	if len(manifest.Manifests) > 0 {
+		digest := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				digest = m.Digest
+				break
+			}
+		}
+		return c.Created(ctx, image.Reference{Registry: ref.Registry, Repository: ref.Repository, Digest: digest})
+	}
+	if manifest.Config.Digest == "" {
+		return time.Time{}, fmt.Errorf("manifest %s of %s has no configuration", manifestRef, ref.Name())
+	}
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := c.getJSON(ctx, ref, c.url(ref, "/blobs/"+manifest.Config.Digest), nil, &config); err != nil {
+		return time.Time{}, err
+	}
+	return config.Created, nil
+}
+
+func (c *Client) url(ref image.Reference, path string) string {
+	host := ref.Registry
+	if host == image.DefaultRegistry {
+		host = dockerHubAPI
+	}
+	scheme := "https"
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + host + "/v2/" + ref.Repository + path
+}
+
+func (c *Client) getJSON(ctx context.Context, ref image.Reference, url string, accept []string, result interface{}) error {
+	res, err := c.get(ctx, ref, url, accept)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// get makes an authenticated GET request, if the registry challenges the
+// request, the credentials or a token are added and the request is retried.
+func (c *Client) get(ctx context.Context, ref image.Reference, url string, accept []string) (*http.Response, error) {
+	scope := "repository:" + ref.Repository + ":pull"
+	res, err := c.do(ctx, url, accept, c.token(ref.Registry, scope))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		auth, err := c.authenticate(ctx, ref.Registry, scope, challenge)
+		if err != nil {
+			return nil, err
+		}
+		res, err = c.do(ctx, url, accept, auth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("GET %s failed with %s: %s", url, res.Status, strings.TrimSpace(string(b)))
+	}
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, url string, accept []string, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.client.Do(req)
+}
+
+func (c *Client) token(registry, scope string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[registry+" "+scope]
+}
+
+// authenticate returns the Authorization header to answer a challenge,
+// bearer tokens are requested from the challenge's realm, and cached for the
+// scope.
+func (c *Client) authenticate(ctx context.Context, registry, scope, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.Username == "" {
+			return "", fmt.Errorf("registry %s requires credentials", registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry %s requested unsupported authentication %q", registry, challenge)
+	}
+
+	u, err := neturl.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry %s returned an invalid token realm %q", registry, params["realm"])
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a token for %s from %s: %s", registry, u.Host, res.Status)
+	}
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode the token for %s: %w", registry, err)
+	}
+	token := result.Token
+	if token == "" {
+		token = result.AccessToken
+	}
+	auth := "Bearer " + token
+	c.mu.Lock()
+	c.tokens[registry+" "+scope] = auth
+	c.mu.Unlock()
+	return auth, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, e.g.
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func parseChallenge(s string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	params := map[string]string{}
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+// nextLink returns the URL of the next page of results from a Link header, or
+// "" if there are no more pages.
+func nextLink(current, link string) (string, error) {
+	m := nextLinkRe.FindStringSubmatch(link)
+	if m == nil {
+		return "", nil
+	}
+	base, err := neturl.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(m[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid link to the next page %q: %w", m[1], err)
+	}
+	return next.String(), nil
+}
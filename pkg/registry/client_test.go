@@ -0,0 +1,203 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+func TestTags(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{
+		"v1.0.0": day(1), "v1.1.0": day(2), "v1.2.0": day(3), "latest": day(3), "main-abc123": day(4),
+	})
+	c := r.client()
+
+	tags, err := c.Tags(context.Background(), r.image("demo/http"))
+	assertNoError(t, err)
+
+	want := []string{"latest", "main-abc123", "v1.0.0", "v1.1.0", "v1.2.0"}
+	if diff := cmp.Diff(want, tags); diff != "" {
+		t.Fatalf("tags didn't match:\n%s", diff)
+	}
+	if r.pages < 3 {
+		t.Fatalf("got %d pages of tags, want at least 3", r.pages)
+	}
+}
+
+func TestTagsWithBearerToken(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1)})
+	r.token = "test-token"
+	c := r.client()
+
+	for i := 0; i < 2; i++ {
+		tags, err := c.Tags(context.Background(), r.image("demo/http"))
+		assertNoError(t, err)
+		if diff := cmp.Diff([]string{"v1.0.0"}, tags); diff != "" {
+			t.Fatalf("tags didn't match:\n%s", diff)
+		}
+	}
+	if r.tokenRequests != 1 {
+		t.Fatalf("got %d token requests, want the token to be reused", r.tokenRequests)
+	}
+}
+
+func TestTagsWithUnknownRepository(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1)})
+
+	_, err := r.client().Tags(context.Background(), r.image("demo/unknown"))
+
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Fatalf("got error %v, want a not found error", err)
+	}
+}
+
+func TestCreated(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1), "v1.1.0": day(2)})
+	r.indexes["v1.1.0"] = true
+	c := r.client()
+
+	for tag, want := range map[string]time.Time{"v1.0.0": day(1), "v1.1.0": day(2)} {
+		ref := r.image("demo/http")
+		ref.Tag = tag
+
+		created, err := c.Created(context.Background(), ref)
+		assertNoError(t, err)
+
+		if !created.Equal(want) {
+			t.Errorf("%s got created %s, want %s", tag, created, want)
+		}
+	}
+}
+
+// testRegistry is an in-process stand-in for a registry, with a single
+// repository "demo/http" that has images created at the tagged times.
+//
+// Tags are returned in pages of two, and if the token is set, requests must
+// have the token from the token endpoint.
+type testRegistry struct {
+	t       *testing.T
+	server  *httptest.Server
+	created map[string]time.Time
+	indexes map[string]bool
+	token   string
+
+	pages         int
+	tokenRequests int
+}
+
+func newTestRegistry(t *testing.T, created map[string]time.Time) *testRegistry {
+	r := &testRegistry{t: t, created: created, indexes: map[string]bool{}}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *testRegistry) client() *Client {
+	return New(r.server.Client())
+}
+
+func (r *testRegistry) image(repository string) image.Reference {
+	return image.MustParse(strings.TrimPrefix(r.server.URL, "https://") + "/" + repository)
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests++
+		if req.URL.Query().Get("scope") != "repository:demo/http:pull" {
+			http.Error(w, "invalid scope", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, map[string]string{"token": r.token})
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, r.server.URL))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/demo/http/")
+	switch {
+	case p == req.URL.Path:
+		http.NotFound(w, req)
+	case p == "tags/list":
+		r.serveTags(w, req)
+	case strings.HasPrefix(p, "manifests/"):
+		r.serveManifest(w, strings.TrimPrefix(p, "manifests/"))
+	case strings.HasPrefix(p, "blobs/config-"):
+		tag := strings.TrimPrefix(p, "blobs/config-")
+		writeJSON(w, map[string]interface{}{"created": r.created[tag], "architecture": "amd64"})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *testRegistry) serveTags(w http.ResponseWriter, req *http.Request) {
+	r.pages++
+	tags := []string{}
+	for k := range r.created {
+		tags = append(tags, k)
+	}
+	sort.Strings(tags)
+	start := 0
+	if last := req.URL.Query().Get("last"); last != "" {
+		start = sort.SearchStrings(tags, last) + 1
+	}
+	end := start + 2
+	if end < len(tags) {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/demo/http/tags/list?n=2&last=%s>; rel="next"`, tags[end-1]))
+	} else {
+		end = len(tags)
+	}
+	writeJSON(w, map[string]interface{}{"name": "demo/http", "tags": tags[start:end]})
+}
+
+// serveManifest serves the manifests for tags, and for digests, which are
+// "sha256:<tag>" in the stand-in.
+func (r *testRegistry) serveManifest(w http.ResponseWriter, ref string) {
+	tag := strings.TrimPrefix(ref, "sha256:")
+	if _, ok := r.created[tag]; !ok {
+		http.Error(w, "manifest unknown", http.StatusNotFound)
+		return
+	}
+	if r.indexes[tag] && ref == tag {
+		writeJSON(w, map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.index.v1+json",
+			"manifests": []map[string]interface{}{
+				{"digest": "sha256:unknown", "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+				{"digest": "sha256:" + tag, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			},
+		})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config":    map[string]string{"digest": "config-" + tag},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func day(n int) time.Time {
+	return time.Date(2020, time.March, n, 0, 0, 0, 0, time.UTC)
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/blang/semver/v4"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+var (
+	// ErrNoMatchingTags is returned when none of an image's tags are selected
+	// by a Policy.
+	ErrNoMatchingTags = errors.New("no matching tags")
+	// ErrTooManyTags is returned when more than MaxInspectedTags would need
+	// their build times to be read.
+	ErrTooManyTags = errors.New("too many tags")
+)
+
+// MaxInspectedTags is the most tags that a Policy without a Semver range
+// reads the build times of, each tag needs requests for its manifest and
+// configuration, so more tags need a Filter.
+var MaxInspectedTags = 100
+
+// InspectWorkers is the number of tags that have their build times read at the
+// same time.
+var InspectWorkers = 4
+
+// Registry is the part of the registry API used to select tags.
+//
+// Created returns the time that the image was built, which is recorded in its
+// configuration, rather than the time that the tag was pushed, registries
+// don't record when tags are pushed.
+type Registry interface {
+	Tags(ctx context.Context, ref image.Reference) ([]string, error)
+	Created(ctx context.Context, ref image.Reference) (time.Time, error)
+}
+
+// Policy selects the newest tag of an image.
+//
+// Tags that don't match the Filter regular expression are ignored, and of the
+// rest, the highest version in the Semver range is selected e.g. ">=1.2.0
+// <2.0.0", versions can have a "v" prefix, and pre-releases are ignored.
+//
+// If there's no Semver range, the most recently built image is selected, which
+// requires reading the configuration of each of the tagged images, so at most
+// MaxInspectedTags can match the Filter. Images are built before they're
+// pushed, so a tag that was pushed later for an older build isn't selected.
+type Policy struct {
+	Semver string `json:"semver,omitempty"`
+	Filter string `json:"filter,omitempty"`
+}
+
+// Select returns the newest tag of an image's repository.
+//
+// If no tags are selected, the error is ErrNoMatchingTags, and if too many tags
+// would need their build times to be read, it's ErrTooManyTags.
+func (p Policy) Select(ctx context.Context, r Registry, ref image.Reference) (string, error) {
+	var versions semver.Range
+	if p.Semver != "" {
+		var err error
+		versions, err = semver.ParseRange(p.Semver)
+		if err != nil {
+			return "", fmt.Errorf("invalid semver range %q: %w", p.Semver, err)
+		}
+	}
+	var filter *regexp.Regexp
+	if p.Filter != "" {
+		var err error
+		filter, err = regexp.Compile(p.Filter)
+		if err != nil {
+			return "", fmt.Errorf("invalid tag filter %q: %w", p.Filter, err)
+		}
+	}
+
+	tags, err := r.Tags(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, tag := range tags {
+		if filter == nil || filter.MatchString(tag) {
+			candidates = append(candidates, tag)
+		}
+	}
+
+	selected := ""
+	if versions != nil {
+		var newest semver.Version
+		for _, tag := range candidates {
+			v, err := semver.ParseTolerant(tag)
+			if err != nil || len(v.Pre) > 0 || !versions(v) {
+				continue
+			}
+			if selected == "" || v.GT(newest) {
+				selected, newest = tag, v
+			}
+		}
+	} else if len(candidates) > 0 {
+		var err error
+		if selected, err = newestBuilt(ctx, r, ref, candidates); err != nil {
+			return "", err
+		}
+	}
+	if selected == "" {
+		return "", fmt.Errorf("%w for %s", ErrNoMatchingTags, ref.Name())
+	}
+	return selected, nil
+}
+
+// newestBuilt returns the tag of the most recently built image, reading the
+// build times of up to InspectWorkers tags at the same time.
+//
+// If more than one image was built at the same time, the first of their tags
+// is returned.
+func newestBuilt(ctx context.Context, r Registry, ref image.Reference, tags []string) (string, error) {
+	if len(tags) > MaxInspectedTags {
+		return "", fmt.Errorf("%w, %d tags of %s would need their build times read, more than %d, use a filter or semver range", ErrTooManyTags, len(tags), ref.Name(), MaxInspectedTags)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	created := make([]time.Time, len(tags))
+	workers := make(chan struct{}, max(1, InspectWorkers))
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i, tag := range tags {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			if ctx.Err() != nil {
+				return
+			}
+			t, err := r.Created(ctx, image.Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: tag})
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to read the build time of %s:%s: %w", ref.Name(), tag, err)
+					cancel()
+				}
+				mu.Unlock()
+				return
+			}
+			created[i] = t
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	selected := 0
+	for i := range tags {
+		if created[i].After(created[selected]) {
+			selected = i
+		}
+	}
+	return tags[selected], nil
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bigkevmcd/peanut/pkg/image"
+)
+
+func TestPolicySelect(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{
+		"v1.0.0":      day(1),
+		"v1.1.0":      day(2),
+		"1.2.0":       day(3),
+		"v2.0.0":      day(4),
+		"v2.1.0-rc.1": day(5),
+		"latest":      day(5),
+		"main-abc123": day(6),
+		"main-def456": day(7),
+	})
+	c := r.client()
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string
+	}{
+		{"latest built", Policy{}, "main-def456"},
+		{"latest built matching the filter", Policy{Filter: "^v"}, "v2.1.0-rc.1"},
+		{"highest version", Policy{Semver: ">=0.0.0"}, "v2.0.0"},
+		{"highest version in range", Policy{Semver: ">=1.0.0 <2.0.0"}, "1.2.0"},
+		{"highest version matching the filter", Policy{Semver: ">=1.0.0 <2.0.0", Filter: "^v"}, "v1.1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, err := tt.policy.Select(context.Background(), c, r.image("demo/http"))
+			assertNoError(t, err)
+
+			if tag != tt.want {
+				t.Fatalf("got tag %q, want %q", tag, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicySelectWithNoMatchingTags(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1)})
+
+	_, err := Policy{Semver: ">=2.0.0"}.Select(context.Background(), r.client(), r.image("demo/http"))
+
+	if !errors.Is(err, ErrNoMatchingTags) {
+		t.Fatalf("got error %v, want %v", err, ErrNoMatchingTags)
+	}
+}
+
+func TestPolicySelectWithInvalidPolicy(t *testing.T) {
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1)})
+
+	for _, p := range []Policy{{Semver: "not a range"}, {Filter: "("}} {
+		if _, err := p.Select(context.Background(), r.client(), r.image("demo/http")); err == nil {
+			t.Errorf("expected an error for %#v", p)
+		}
+	}
+}
+
+func TestPolicySelectWithTooManyTags(t *testing.T) {
+	setMaxInspectedTags(t, 2)
+	r := newTestRegistry(t, map[string]time.Time{"v1.0.0": day(1), "v1.1.0": day(2), "v1.2.0": day(3)})
+
+	_, err := Policy{}.Select(context.Background(), r.client(), r.image("demo/http"))
+	if !errors.Is(err, ErrTooManyTags) {
+		t.Fatalf("got error %v, want %v", err, ErrTooManyTags)
+	}
+
+	for _, p := range []Policy{{Filter: "^v1.[01]"}, {Semver: ">=1.0.0"}} {
+		if _, err := p.Select(context.Background(), r.client(), r.image("demo/http")); err != nil {
+			t.Errorf("%#v failed: %s", p, err)
+		}
+	}
+}
+
+func TestPolicySelectLimitsConcurrentInspections(t *testing.T) {
+	r := &countingRegistry{created: map[string]time.Time{}}
+	for i := 1; i <= 20; i++ {
+		r.created[fmt.Sprintf("build-%d", i)] = day(i)
+	}
+
+	tag, err := Policy{}.Select(context.Background(), r, image.MustParse("example.com/demo/http"))
+	assertNoError(t, err)
+
+	if tag != "build-20" {
+		t.Fatalf("got tag %q, want %q", tag, "build-20")
+	}
+	if r.most > InspectWorkers {
+		t.Fatalf("got %d concurrent inspections, want at most %d", r.most, InspectWorkers)
+	}
+}
+
+func setMaxInspectedTags(t *testing.T, n int) {
+	old := MaxInspectedTags
+	MaxInspectedTags = n
+	t.Cleanup(func() { MaxInspectedTags = old })
+}
+
+// countingRegistry records the most calls to Created at the same time.
+type countingRegistry struct {
+	created map[string]time.Time
+
+	mu      sync.Mutex
+	current int
+	most    int
+}
+
+func (r *countingRegistry) Tags(ctx context.Context, ref image.Reference) ([]string, error) {
+	tags := []string{}
+	for k := range r.created {
+		tags = append(tags, k)
+	}
+	return tags, nil
+}
+
+func (r *countingRegistry) Created(ctx context.Context, ref image.Reference) (time.Time, error) {
+	r.mu.Lock()
+	r.current++
+	r.most = max(r.most, r.current)
+	r.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	r.mu.Lock()
+	r.current--
+	r.mu.Unlock()
+	return r.created[ref.Tag], nil
+}
@@ -0,0 +1,140 @@
+// Package render builds the Kubernetes manifests for an environment, and
+// compares them between revisions.
+package render
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+// The changes to a resource between two revisions.
+const (
+	ResourceAdded   = "added"
+	ResourceRemoved = "removed"
+	ResourceChanged = "changed"
+)
+
+// ResourceDiff is the difference between a rendered resource at two
+// revisions.
+//
+// Resources are identified by their group, kind, namespace and name, so a
+// change to the version of a resource's API is a change to the resource. The
+// Diff is a unified diff of the resource's YAML, and is empty for added and
+// removed resources, which have their YAML in Base or Head.
+type ResourceDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Change     string `json:"change"`
+	Base       string `json:"base,omitempty"`
+	Head       string `json:"head,omitempty"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+// ID returns a readable identifier for the resource, e.g.
+// "Deployment dev/go-demo-http".
+func (d *ResourceDiff) ID() string {
+	if d.Namespace == "" {
+		return d.Kind + " " + d.Name
+	}
+	return d.Kind + " " + d.Namespace + "/" + d.Name
+}
+
+// DiffFileSystems builds the kustomization at the path in two filesystems,
+// usually two revisions of a repository, and compares the rendered resources.
+func DiffFileSystems(path string, base, head filesys.FileSystem) ([]*ResourceDiff, error) {
+	baseResources, err := parser.ParseTreeToResMap(path, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the base: %w", err)
+	}
+	headResources, err := parser.ParseTreeToResMap(path, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the head: %w", err)
+	}
+	return Diff(baseResources, headResources)
+}
+
+// Diff compares two sets of rendered resources, and returns the resources that
+// differ, ordered by kind, namespace and name.
+func Diff(base, head resmap.ResMap) ([]*ResourceDiff, error) {
+	baseYAML, err := resourcesByKey(base)
+	if err != nil {
+		return nil, err
+	}
+	headYAML, err := resourcesByKey(head)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []*ResourceDiff{}
+	for k, b := range baseYAML {
+		d := &ResourceDiff{APIVersion: b.apiVersion, Kind: k.kind, Namespace: k.namespace, Name: k.name}
+		h, ok := headYAML[k]
+		switch {
+		case !ok:
+			d.Change, d.Base = ResourceRemoved, b.yaml
+		case b.yaml != h.yaml:
+			d.Change, d.APIVersion = ResourceChanged, h.apiVersion
+			d.Diff = UnifiedDiff("base/"+d.ID(), "head/"+d.ID(), b.yaml, h.yaml)
+		default:
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+	for k, h := range headYAML {
+		if _, ok := baseYAML[k]; !ok {
+			diffs = append(diffs, &ResourceDiff{
+				APIVersion: h.apiVersion,
+				Kind:       k.kind,
+				Namespace:  k.namespace,
+				Name:       k.name,
+				Change:     ResourceAdded,
+				Head:       h.yaml,
+			})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return diffs, nil
+}
+
+type resourceKey struct {
+	group, kind, namespace, name string
+}
+
+type renderedResource struct {
+	apiVersion string
+	yaml       string
+}
+
+func resourcesByKey(m resmap.ResMap) (map[resourceKey]renderedResource, error) {
+	result := map[resourceKey]renderedResource{}
+	for _, r := range m.Resources() {
+		b, err := r.AsYAML()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", r.CurId(), err)
+		}
+		result[keyFor(r)] = renderedResource{apiVersion: r.GetGvk().ApiVersion(), yaml: string(b)}
+	}
+	return result, nil
+}
+
+func keyFor(r *resource.Resource) resourceKey {
+	gvk := r.GetGvk()
+	return resourceKey{group: gvk.Group, kind: gvk.Kind, namespace: r.GetNamespace(), name: r.GetName()}
+}
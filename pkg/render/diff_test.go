@@ -0,0 +1,106 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+)
+
+func TestDiffFileSystems(t *testing.T) {
+	base := gitfs.NewDir("testdata")
+	head := gitfs.NewOverlay(base)
+	writeFile(t, head, "app/kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: dev
+resources:
+- deployment.yaml
+- service.yaml
+images:
+- name: example.com/http
+  newTag: v1.1.0
+`)
+	writeFile(t, head, "app/service.yaml", `apiVersion: v1
+kind: Service
+metadata:
+  name: http
+spec:
+  ports:
+  - port: 80
+`)
+
+	diffs, err := DiffFileSystems("app", base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*ResourceDiff{
+		{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Namespace:  "dev",
+			Name:       "http-config",
+			Change:     ResourceRemoved,
+			Base:       "apiVersion: v1\ndata:\n  LOG_LEVEL: info\nkind: ConfigMap\nmetadata:\n  labels:\n    tier: config\n  name: http-config\n  namespace: dev\n",
+		},
+		{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Namespace:  "dev",
+			Name:       "http",
+			Change:     ResourceChanged,
+			Diff: `--- base/Deployment dev/http
++++ head/Deployment dev/http
+@@ -8,5 +8,5 @@
+   template:
+     spec:
+       containers:
+-      - image: example.com/http:v1.0.0
++      - image: example.com/http:v1.1.0
+         name: http
+`,
+		},
+		{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Namespace:  "dev",
+			Name:       "http",
+			Change:     ResourceAdded,
+			Head:       "apiVersion: v1\nkind: Service\nmetadata:\n  name: http\n  namespace: dev\nspec:\n  ports:\n  - port: 80\n",
+		},
+	}
+	if diff := cmp.Diff(want, diffs); diff != "" {
+		t.Fatalf("failed to diff resources:\n%s", diff)
+	}
+}
+
+func TestDiffFileSystemsWithNoChanges(t *testing.T) {
+	base := gitfs.NewDir("testdata")
+
+	diffs, err := DiffFileSystems("app", base, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("got %d diffs, want none", len(diffs))
+	}
+}
+
+func TestDiffFileSystemsWithBrokenHead(t *testing.T) {
+	base := gitfs.NewDir("testdata")
+	head := gitfs.NewOverlay(base)
+	writeFile(t, head, "app/kustomization.yaml", "resources:\n- unknown.yaml\n")
+
+	_, err := DiffFileSystems("app", base, head)
+	if err == nil {
+		t.Fatal("expected an error building the head")
+	}
+}
+
+func writeFile(t *testing.T, o *gitfs.Overlay, name, body string) {
+	t.Helper()
+	if err := o.WriteFile(name, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+}
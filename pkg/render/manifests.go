@@ -0,0 +1,97 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/kustomize/parser"
+)
+
+// ErrInvalidSelector is returned when a Filter's Selector can't be parsed.
+var ErrInvalidSelector = errors.New("invalid label selector")
+
+// Filter selects rendered resources.
+//
+// Kind is compared without case, so "deployment" selects Deployments, and
+// Selector is a Kubernetes label selector e.g. "app.kubernetes.io/name=http".
+// Empty fields select all resources.
+type Filter struct {
+	Kind     string
+	Name     string
+	Selector string
+}
+
+// Manifests builds the kustomization at the path, and returns the resources
+// that match the filter, in the order that Kustomize renders them.
+func Manifests(path string, files filesys.FileSystem, f Filter) ([]*resource.Resource, error) {
+	m, err := parser.ParseTreeToResMap(path, files)
+	if err != nil {
+		return nil, err
+	}
+	var result []*resource.Resource
+	for _, r := range m.Resources() {
+		ok, err := f.matches(r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (f Filter) matches(r *resource.Resource) (bool, error) {
+	if f.Kind != "" && !strings.EqualFold(f.Kind, r.GetKind()) {
+		return false, nil
+	}
+	if f.Name != "" && f.Name != r.GetName() {
+		return false, nil
+	}
+	if f.Selector == "" {
+		return true, nil
+	}
+	ok, err := r.MatchesLabelSelector(f.Selector)
+	if err != nil {
+		return false, fmt.Errorf("%w %q: %s", ErrInvalidSelector, f.Selector, err)
+	}
+	return ok, nil
+}
+
+// WriteYAML writes the resources as a multi-document YAML stream.
+func WriteYAML(w io.Writer, resources []*resource.Resource) error {
+	for i, r := range resources {
+		b, err := r.AsYAML()
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", r.CurId(), err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the resources as a JSON list.
+func WriteJSON(w io.Writer, resources []*resource.Resource) error {
+	result := []map[string]interface{}{}
+	for _, r := range resources {
+		m, err := r.Map()
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", r.CurId(), err)
+		}
+		result = append(result, m)
+	}
+	return json.NewEncoder(w).Encode(result)
+}
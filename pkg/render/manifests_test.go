@@ -0,0 +1,118 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+)
+
+func TestManifests(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"no filter", Filter{}, []string{"Deployment http", "ConfigMap http-config"}},
+		{"kind", Filter{Kind: "deployment"}, []string{"Deployment http"}},
+		{"name", Filter{Name: "http-config"}, []string{"ConfigMap http-config"}},
+		{"selector", Filter{Selector: "tier=config"}, []string{"ConfigMap http-config"}},
+		{"no matches", Filter{Kind: "Deployment", Selector: "tier=config"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, err := Manifests("app", gitfs.NewDir("testdata"), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range resources {
+				got = append(got, r.GetKind()+" "+r.GetName())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("failed to filter resources:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestManifestsWithInvalidSelector(t *testing.T) {
+	_, err := Manifests("app", gitfs.NewDir("testdata"), Filter{Selector: "tier in (config"})
+	if !errors.Is(err, ErrInvalidSelector) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidSelector)
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	resources, err := Manifests("app", gitfs.NewDir("testdata"), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteYAML(&b, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: http
+  namespace: dev
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: example.com/http:v1.0.0
+        name: http
+---
+apiVersion: v1
+data:
+  LOG_LEVEL: info
+kind: ConfigMap
+metadata:
+  labels:
+    tier: config
+  name: http-config
+  namespace: dev
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("failed to write YAML:\n%s", diff)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	resources, err := Manifests("app", gitfs.NewDir("testdata"), Filter{Kind: "ConfigMap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteJSON(&b, resources); err != nil {
+		t.Fatal(err)
+	}
+	var got []interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"labels":    map[string]interface{}{"tier": "config"},
+				"name":      "http-config",
+				"namespace": "dev",
+			},
+			"data": map[string]interface{}{"LOG_LEVEL": "info"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("failed to write JSON:\n%s", diff)
+	}
+}
@@ -0,0 +1,243 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines around the changes in a hunk.
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// UnifiedDiff returns a unified diff of two texts, or "" if they're the same,
+// the names are used in the "---" and "+++" headers.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+	hunks := hunks(ops)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		b.WriteString(h)
+	}
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits that turn a into b, from a shortest edit script
+// of their lines.
+//
+// This is Myers' O(ND) algorithm, with the linear space refinement, so that
+// large resources can be compared without a table of their lines, and within
+// each change the deleted lines come before the inserted lines.
+func diffLines(a, b []string) []op {
+	ops := appendEdits(make([]op, 0, len(a)+len(b)), a, b)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != opEqual {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(x, y int) bool {
+			return ops[i+x].kind == opDelete && ops[i+y].kind == opInsert
+		})
+		i = j
+	}
+	return ops
+}
+
+// appendEdits appends the edits that turn a into b to ops, the texts are
+// divided at the middle snake of the edit script, and each side is diffed
+// separately.
+func appendEdits(ops []op, a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, op{opEqual, a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, v := range b {
+			ops = append(ops, op{opInsert, v})
+		}
+	case len(b) == 0:
+		for _, v := range a {
+			ops = append(ops, op{opDelete, v})
+		}
+	default:
+		x, y, u, v := middleSnake(a, b)
+		ops = appendEdits(ops, a[:x], b[:y])
+		for _, line := range a[x:u] {
+			ops = append(ops, op{opEqual, line})
+		}
+		ops = appendEdits(ops, a[u:], b[v:])
+	}
+
+	for _, v := range common {
+		ops = append(ops, op{opEqual, v})
+	}
+	return ops
+}
+
+// middleSnake returns the start and end of the snake in the middle of a
+// shortest edit script from a to b, by searching forwards from the start and
+// backwards from the end at the same time, until the searches overlap.
+//
+// The texts must be non-empty, with different first and last lines, so that
+// both halves of the script have edits.
+func middleSnake(a, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n+m+1)/2 + 1
+	// forward is the furthest x on each diagonal k = x - y from the start,
+	// backward is the furthest distance on each diagonal from the end, both
+	// offset by the limit.
+	forward, backward := make([]int, 2*limit+1), make([]int, 2*limit+1)
+	for d := 0; d < limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[limit+k-1] < forward[limit+k+1]) {
+				x = forward[limit+k+1]
+			} else {
+				x = forward[limit+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[limit+k] = x
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+backward[limit+c] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || (c != d && backward[limit+c-1] < backward[limit+c+1]) {
+				x = backward[limit+c+1]
+			} else {
+				x = backward[limit+c-1] + 1
+			}
+			y := x - c
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[limit+c] = x
+			if k := delta - c; !odd && k >= -d && k <= d && forward[limit+k]+x >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	panic("render: no middle snake in the edit script")
+}
+
+// hunks groups the edits into hunks with contextLines of unchanged lines
+// around each change.
+func hunks(ops []op) []string {
+	var result []string
+	// aLine and bLine are the number of lines of each text before ops[i].
+	aLines, bLines := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if o.kind != opInsert {
+			aLines[i+1]++
+		}
+		if o.kind != opDelete {
+			bLines[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		start := max(0, i-contextLines)
+		// Extend the hunk until there are more than twice the context lines
+		// of unchanged lines, or the end.
+		end, equal := i, 0
+		for end < len(ops) && equal <= 2*contextLines {
+			if ops[end].kind == opEqual {
+				equal++
+			} else {
+				equal = 0
+			}
+			end++
+		}
+		if equal > contextLines {
+			end -= equal - contextLines
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[end]-aLines[start]),
+			hunkRange(bLines[start], bLines[end]-bLines[start]))
+		for _, o := range ops[start:end] {
+			prefix := " "
+			switch o.kind {
+			case opDelete:
+				prefix = "-"
+			case opInsert:
+				prefix = "+"
+			}
+			b.WriteString(prefix + o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		result = append(result, b.String())
+		i = end
+	}
+	return result
+}
+
+// hunkRange formats the start and length of a hunk, the start of an empty
+// range is the line before it.
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	diffTests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{"no changes", "a\nb\n", "a\nb\n", ""},
+		{
+			"changed line",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- base\n+++ head\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"added to empty",
+			"",
+			"a\nb\n",
+			"--- base\n+++ head\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"removed everything",
+			"a\n",
+			"",
+			"--- base\n+++ head\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			"--- base\n+++ head\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			"joined hunks",
+			"1\n2\n3\n4\n5\n6\n7\n",
+			"one\n2\n3\n4\n5\n6\nseven\n",
+			"--- base\n+++ head\n@@ -1,7 +1,7 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n-7\n+seven\n",
+		},
+		{
+			"missing newline",
+			"a\nb",
+			"a\nc",
+			"--- base\n+++ head\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range diffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("base", "head", tt.from, tt.to)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("incorrect diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffWithLargeTexts(t *testing.T) {
+	var from, to strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&from, "line %d\n", i)
+		if i == 50000 {
+			to.WriteString("changed\n")
+			continue
+		}
+		fmt.Fprintf(&to, "line %d\n", i)
+	}
+
+	got := UnifiedDiff("base", "head", from.String(), to.String())
+
+	want := "--- base\n+++ head\n@@ -49998,7 +49998,7 @@\n line 49997\n line 49998\n line 49999\n-line 50000\n+changed\n line 50001\n line 50002\n line 50003\n"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect diff:\n%s", diff)
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+)
+
+var (
+	// ErrNoChanges is returned when committing a Commit without any changes.
+	ErrNoChanges = errors.New("no changes to commit")
+	// ErrNotBranch is returned when a Commit has no branch, and its revision
+	// is a tag or a commit, rather than a branch that it can be pushed to.
+	ErrNotBranch = errors.New("revision is not a branch")
+)
+
+// Commit is a set of changes to commit to a repository.
+type Commit struct {
+	// Parent is the commit that the changes were made to, the HEAD of the
+	// remote repository is used if it's not set.
+	Parent plumbing.Hash
+	// Revision is the branch, tag or commit that the parent was read from, an
+	// empty revision is the HEAD of the remote repository.
+	Revision string
+	Changes  []gitfs.Change
+	Message  string
+
+	Author    object.Signature
+	Committer object.Signature
+
+	// Branch is the branch to push the commit to, if it's empty, the commit is
+	// pushed to the Revision if it's a branch, or to the default branch of the
+	// remote repository if there's no Revision.
+	Branch string
+}
+
+// Committer creates commits from changed files, and pushes them to remote
+// repositories.
+type Committer struct {
+	auth AuthFunc
+}
+
+// NewCommitter creates and returns a new Committer.
+//
+// The auth func is called before each clone and push, it can be nil if no
+// repositories need authentication.
+func NewCommitter(auth AuthFunc) *Committer {
+	return &Committer{auth: auth}
+}
+
+// Commit clones the repository into memory, applies the changes to the parent
+// commit, and pushes the new commit to the branch, it returns the pushed
+// commit and the branch that it was pushed to.
+//
+// Pushes that aren't fast-forwards are rejected, so pushing to a branch that
+// has moved on from the parent commit fails, rather than losing the commits.
+func (c *Committer) Commit(ctx context.Context, url string, commit *Commit) (plumbing.Hash, string, error) {
+	if len(commit.Changes) == 0 {
+		return plumbing.ZeroHash, "", ErrNoChanges
+	}
+	var auth transport.AuthMethod
+	if c.auth != nil {
+		var err error
+		auth, err = c.auth(url)
+		if err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+	}
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), memfs.New(), &git.CloneOptions{
+		URL:        url,
+		Auth:       auth,
+		NoCheckout: true,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("failed to clone %s: %w", redactURL(url), err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+	branch := commit.Branch
+	if branch == "" {
+		if branch, err = revisionBranch(repo, head, commit.Revision); err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+	}
+	parent := commit.Parent
+	if parent.IsZero() {
+		parent = head.Hash()
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: parent, Force: true}); err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("failed to checkout %s: %w", parent, err)
+	}
+
+	for _, change := range commit.Changes {
+		if change.Removed {
+			if _, err := wt.Remove(change.Path); err != nil {
+				return plumbing.ZeroHash, "", err
+			}
+			continue
+		}
+		if err := util.WriteFile(wt.Filesystem, change.Path, change.Contents, 0644); err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+		if _, err := wt.Add(change.Path); err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+	}
+	author, committer := commit.Author, commit.Committer
+	h, err := wt.Commit(commit.Message, &git.CommitOptions{Author: &author, Committer: &committer})
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	ref := plumbing.NewBranchReferenceName(branch)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(ref, h)); err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remoteName,
+		Auth:       auth,
+		RefSpecs:   []config.RefSpec{config.RefSpec(ref + ":" + ref)},
+	})
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("failed to push to %s in %s: %w", branch, redactURL(url), err)
+	}
+	return h, branch, nil
+}
+
+// revisionBranch returns the branch that a revision names, or the remote's
+// default branch if there's no revision, tags and commits are not branches.
+func revisionBranch(repo *git.Repository, head *plumbing.Reference, rev string) (string, error) {
+	if rev == "" || rev == string(plumbing.HEAD) {
+		return head.Name().Short(), nil
+	}
+	name := strings.TrimPrefix(rev, "refs/heads/")
+	if _, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, name), false); err != nil {
+		return "", fmt.Errorf("can't push to %s: %w", rev, ErrNotBranch)
+	}
+	return name, nil
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+)
+
+func TestCommitToDefaultBranch(t *testing.T) {
+	remote := newTestRemote(t)
+	first := remote.commit("version: 1\n")
+	bare := newBareRemote(t, remote)
+	c := NewCommitter(nil)
+
+	h, branch, err := c.Commit(context.Background(), bare, &Commit{
+		Changes: []gitfs.Change{
+			{Path: "config.yaml", Contents: []byte("version: 2\n")},
+			{Path: "envs/production.yaml", Contents: []byte("replicas: 3\n")},
+		},
+		Message:   "Update the version",
+		Author:    testSignature("Author"),
+		Committer: testSignature("Committer"),
+	})
+	assertNoError(t, err)
+
+	if branch != "master" {
+		t.Fatalf("got branch %q, want %q", branch, "master")
+	}
+	gfs, commit, err := New(nil).FileSystem(context.Background(), bare, "master")
+	assertNoError(t, err)
+	if commit != h {
+		t.Fatalf("got commit %s on master, want %s", commit, h)
+	}
+	assertFileContents(t, gfs, "config.yaml", "version: 2\n")
+	assertFileContents(t, gfs, "envs/production.yaml", "replicas: 3\n")
+
+	pushed := readCommit(t, bare, h)
+	if pushed.Message != "Update the version" {
+		t.Errorf("got message %q", pushed.Message)
+	}
+	if pushed.Author.Name != "Author" || pushed.Committer.Name != "Committer" {
+		t.Errorf("got author %q and committer %q", pushed.Author.Name, pushed.Committer.Name)
+	}
+	if len(pushed.ParentHashes) != 1 || pushed.ParentHashes[0] != first {
+		t.Errorf("got parents %v, want %s", pushed.ParentHashes, first)
+	}
+}
+
+func TestCommitToNewBranch(t *testing.T) {
+	remote := newTestRemote(t)
+	first := remote.commit("version: 1\n")
+	bare := newBareRemote(t, remote)
+	c := NewCommitter(nil)
+
+	h, branch, err := c.Commit(context.Background(), bare, &Commit{
+		Parent:    first,
+		Changes:   []gitfs.Change{{Path: "config.yaml", Removed: true}},
+		Message:   "Remove the configuration",
+		Author:    testSignature("Author"),
+		Committer: testSignature("Author"),
+		Branch:    "remove-config",
+	})
+	assertNoError(t, err)
+
+	if branch != "remove-config" {
+		t.Fatalf("got branch %q, want %q", branch, "remove-config")
+	}
+	m := New(nil)
+	gfs, commit, err := m.FileSystem(context.Background(), bare, "remove-config")
+	assertNoError(t, err)
+	if commit != h {
+		t.Fatalf("got commit %s on remove-config, want %s", commit, h)
+	}
+	if gfs.Exists("config.yaml") {
+		t.Fatal("config.yaml was not removed")
+	}
+	_, commit, err = m.FileSystem(context.Background(), bare, "master")
+	assertNoError(t, err)
+	if commit != first {
+		t.Fatalf("master was updated to %s, want %s", commit, first)
+	}
+}
+
+func TestCommitToRevisionBranch(t *testing.T) {
+	remote := newTestRemote(t)
+	remote.commit("version: 1\n")
+	release := remote.commit("version: 1.4\n")
+	second := remote.commit("version: 2\n")
+	bare := newBareRemote(t, remote)
+	setBranch(t, bare, "release-1.4", release)
+	c := NewCommitter(nil)
+
+	h, branch, err := c.Commit(context.Background(), bare, &Commit{
+		Parent:    release,
+		Revision:  "release-1.4",
+		Changes:   []gitfs.Change{{Path: "config.yaml", Contents: []byte("version: 1.4.1\n")}},
+		Message:   "Update the version",
+		Author:    testSignature("Author"),
+		Committer: testSignature("Author"),
+	})
+	assertNoError(t, err)
+
+	if branch != "release-1.4" {
+		t.Fatalf("got branch %q, want %q", branch, "release-1.4")
+	}
+	m := New(nil)
+	_, commit, err := m.FileSystem(context.Background(), bare, "release-1.4")
+	assertNoError(t, err)
+	if commit != h {
+		t.Fatalf("got commit %s on release-1.4, want %s", commit, h)
+	}
+	_, commit, err = m.FileSystem(context.Background(), bare, "master")
+	assertNoError(t, err)
+	if commit != second {
+		t.Fatalf("master was updated to %s, want %s", commit, second)
+	}
+}
+
+func TestCommitToRevisionThatIsNotBranch(t *testing.T) {
+	remote := newTestRemote(t)
+	first := remote.commit("version: 1\n")
+	bare := newBareRemote(t, remote)
+
+	_, _, err := NewCommitter(nil).Commit(context.Background(), bare, &Commit{
+		Parent:    first,
+		Revision:  first.String(),
+		Changes:   []gitfs.Change{{Path: "config.yaml", Contents: []byte("version: 2\n")}},
+		Message:   "Update the version",
+		Author:    testSignature("Author"),
+		Committer: testSignature("Author"),
+	})
+
+	if !errors.Is(err, ErrNotBranch) {
+		t.Fatalf("got error %v, want %v", err, ErrNotBranch)
+	}
+}
+
+func TestCommitWithOutdatedParent(t *testing.T) {
+	remote := newTestRemote(t)
+	first := remote.commit("version: 1\n")
+	remote.commit("version: 2\n")
+	bare := newBareRemote(t, remote)
+	c := NewCommitter(nil)
+
+	_, _, err := c.Commit(context.Background(), bare, &Commit{
+		Parent:    first,
+		Changes:   []gitfs.Change{{Path: "config.yaml", Contents: []byte("version: 3\n")}},
+		Message:   "Update the version",
+		Author:    testSignature("Author"),
+		Committer: testSignature("Author"),
+	})
+	if err == nil {
+		t.Fatal("expected the push to be rejected")
+	}
+}
+
+func TestCommitWithNoChanges(t *testing.T) {
+	_, _, err := NewCommitter(nil).Commit(context.Background(), "unused", &Commit{})
+
+	if !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("got error %v, want %v", err, ErrNoChanges)
+	}
+}
+
+// newBareRemote creates a bare clone of a test remote on disk, to push to.
+func newBareRemote(t *testing.T, remote *testRemote) string {
+	t.Helper()
+	dir := t.TempDir()
+	_, err := git.PlainClone(dir, true, &git.CloneOptions{URL: remote.dir})
+	assertNoError(t, err)
+	return dir
+}
+
+// setBranch points a branch of a bare remote at a commit.
+func setBranch(t *testing.T, dir, name string, h plumbing.Hash) {
+	t.Helper()
+	r, err := git.PlainOpen(dir)
+	assertNoError(t, err)
+	assertNoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), h)))
+}
+
+func readCommit(t *testing.T, dir string, h plumbing.Hash) *object.Commit {
+	t.Helper()
+	r, err := git.PlainOpen(dir)
+	assertNoError(t, err)
+	c, err := r.CommitObject(h)
+	assertNoError(t, err)
+	return c
+}
+
+func testSignature(name string) object.Signature {
+	return object.Signature{Name: name, Email: "testing@example.com", When: time.Now()}
+}
@@ -0,0 +1,349 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/bigkevmcd/peanut/pkg/gitfs"
+)
+
+const remoteName = "origin"
+
+// maxCachedTrees is the number of commit filesystems that are kept for each
+// repository, the least recently used are dropped first.
+const maxCachedTrees = 32
+
+// The remote branches are mirrored to local branches, so that resolving a
+// branch always gets the most recently fetched commit.
+var fetchRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// AuthFunc returns the authentication for a repository URL, or nil if the
+// repository doesn't need authentication.
+type AuthFunc func(url string) (transport.AuthMethod, error)
+
+// Manager keeps a single in-memory clone of each repository, and hands out
+// read-only filesystems for the commits within them.
+//
+// Repositories are cloned the first time they're requested, and updated with
+// incremental fetches, either on demand with Fetch, or on a schedule with
+// Poll.
+type Manager struct {
+	auth  AuthFunc
+	mu    sync.Mutex
+	repos map[string]*repository
+}
+
+// New creates and returns a new Manager.
+//
+// The auth func is called before each clone and fetch, so that rotated
+// credentials are picked up, it can be nil if no repositories need
+// authentication.
+func New(auth AuthFunc) *Manager {
+	return &Manager{auth: auth, repos: map[string]*repository{}}
+}
+
+// FileSystem returns a read-only filesystem with the files from a revision of
+// a repository, along with the commit that the revision resolved to.
+//
+// The revision can be a branch, tag or commit SHA, the HEAD of the remote
+// repository is used if the revision is empty.
+//
+// Filesystems are shared between callers that resolve to the same commit.
+//
+// Repositories with "file://" URLs are read in place with gitfs.NewLocal,
+// rather than cloned.
+func (m *Manager) FileSystem(ctx context.Context, url, rev string) (filesys.FileSystem, plumbing.Hash, error) {
+	if dir, ok := gitfs.LocalPath(url); ok {
+		return gitfs.NewLocal(dir, rev)
+	}
+	r, err := m.repository(ctx, url)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	return r.fileSystem(rev)
+}
+
+// Branch returns the branch that a revision of a repository names, it returns
+// ErrNotBranch if the revision is empty, or a tag or a commit.
+//
+// Repositories with "file://" URLs are read in place, like FileSystem.
+func (m *Manager) Branch(ctx context.Context, url, rev string) (string, error) {
+	var repo *git.Repository
+	if dir, ok := gitfs.LocalPath(url); ok {
+		r, err := git.PlainOpen(dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", dir, err)
+		}
+		repo = r
+	} else {
+		r, err := m.repository(ctx, url)
+		if err != nil {
+			return "", err
+		}
+		repo = r.repo.Load()
+	}
+	name := strings.TrimPrefix(rev, "refs/heads/")
+	if name == "" {
+		return "", ErrNotBranch
+	}
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(name), false); err != nil {
+		return "", fmt.Errorf("%s: %w", rev, ErrNotBranch)
+	}
+	return name, nil
+}
+
+// Fetch fetches any changes to a repository, the repository is cloned if it
+// hasn't been requested before.
+//
+// Local repositories are always read in place, so there's nothing to fetch.
+func (m *Manager) Fetch(ctx context.Context, url string) error {
+	if _, ok := gitfs.LocalPath(url); ok {
+		return nil
+	}
+	m.mu.Lock()
+	r, ok := m.repos[url]
+	m.mu.Unlock()
+	if !ok {
+		_, err := m.repository(ctx, url)
+		return err
+	}
+	return r.fetch(ctx)
+}
+
+// FetchAll fetches changes to all the repositories that have been cloned.
+func (m *Manager) FetchAll(ctx context.Context) error {
+	var errs []error
+	for _, url := range m.URLs() {
+		if err := m.Fetch(ctx, url); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Poll calls FetchAll every interval until the context is cancelled, it
+// returns immediately if the interval isn't positive.
+//
+// Errors are logged rather than returned, so that a single unavailable
+// repository doesn't stop the others from being updated.
+func (m *Manager) Poll(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.FetchAll(ctx); err != nil {
+				log.Printf("failed to fetch repositories: %s", err)
+			}
+		}
+	}
+}
+
+// URLs returns the URLs of the repositories that have been cloned, in order.
+func (m *Manager) URLs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urls := make([]string, 0, len(m.repos))
+	for k, v := range m.repos {
+		if v.cloned() {
+			urls = append(urls, k)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// repository returns the managed repository for a URL, cloning it if this is
+// the first request for the URL.
+func (m *Manager) repository(ctx context.Context, url string) (*repository, error) {
+	m.mu.Lock()
+	r, ok := m.repos[url]
+	if !ok {
+		r = &repository{url: url, auth: m.auth}
+		m.repos[url] = r
+	}
+	m.mu.Unlock()
+	if err := r.clone(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// repository is a single managed clone.
+type repository struct {
+	url  string
+	auth AuthFunc
+
+	// mu serialises clones and fetches.
+	mu   sync.Mutex
+	repo atomic.Pointer[git.Repository]
+
+	cacheMu sync.Mutex
+	trees   map[plumbing.Hash]*list.Element
+	lru     *list.List
+}
+
+// cachedTree is an entry in the least recently used list of filesystems.
+type cachedTree struct {
+	hash plumbing.Hash
+	fs   filesys.FileSystem
+}
+
+func (r *repository) cloned() bool {
+	return r.repo.Load() != nil
+}
+
+// clone creates the in-memory repository if it doesn't already exist, a
+// failed clone is retried on the next request.
+func (r *repository) clone(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cloned() {
+		return nil
+	}
+	repo, err := git.Init(newLockingStorage(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name:  remoteName,
+		URLs:  []string{r.url},
+		Fetch: fetchRefSpecs,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.fetchRepository(ctx, repo); err != nil {
+		return fmt.Errorf("failed to clone %s: %w", redactURL(r.url), err)
+	}
+	r.resetTrees()
+	r.repo.Store(repo)
+	return nil
+}
+
+// fetch updates the branches and tags from the remote repository.
+func (r *repository) fetch(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repo.Load()
+	if repo == nil {
+		return fmt.Errorf("repository %s has not been cloned", redactURL(r.url))
+	}
+	updated, err := r.fetchRepository(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", redactURL(r.url), err)
+	}
+	if updated {
+		// Drop the filesystems for commits that branches no longer point at.
+		r.cacheMu.Lock()
+		r.resetTrees()
+		r.cacheMu.Unlock()
+	}
+	return nil
+}
+
+func (r *repository) fileSystem(rev string) (filesys.FileSystem, plumbing.Hash, error) {
+	commit, err := gitfs.ResolveCommit(r.repo.Load(), rev)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	if e, ok := r.trees[commit.Hash]; ok {
+		r.lru.MoveToFront(e)
+		return e.Value.(*cachedTree).fs, commit.Hash, nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	gfs, err := gitfs.New(tree)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	r.trees[commit.Hash] = r.lru.PushFront(&cachedTree{hash: commit.Hash, fs: gfs})
+	if r.lru.Len() > maxCachedTrees {
+		oldest := r.lru.Remove(r.lru.Back()).(*cachedTree)
+		delete(r.trees, oldest.hash)
+	}
+	return gfs, commit.Hash, nil
+}
+
+// resetTrees drops all the cached filesystems, the caller must hold cacheMu,
+// or be the only user of the repository.
+func (r *repository) resetTrees() {
+	r.trees = map[plumbing.Hash]*list.Element{}
+	r.lru = list.New()
+}
+
+// fetchRepository fetches the branches and tags from the remote, removing any
+// that were deleted from the remote, and points HEAD at the remote's HEAD, it
+// returns true if any references were updated.
+func (r *repository) fetchRepository(ctx context.Context, repo *git.Repository) (bool, error) {
+	var auth transport.AuthMethod
+	if r.auth != nil {
+		var err error
+		auth, err = r.auth(r.url)
+		if err != nil {
+			return false, err
+		}
+	}
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return false, err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return false, err
+	}
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		Auth:       auth,
+		Tags:       git.NoTags,
+		Force:      true,
+		Prune:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return false, err
+	}
+	updated := err == nil
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			return updated, repo.Storer.SetReference(ref)
+		}
+	}
+	return updated, nil
+}
+
+// redactURL replaces any password in a URL, so that it can be logged.
+func redactURL(s string) string {
+	u, err := neturl.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
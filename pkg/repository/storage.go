@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// lockingStorage wraps the go-git in-memory storage, which is not safe for
+// concurrent use, so that objects can be read while a fetch is writing new
+// objects and references.
+type lockingStorage struct {
+	*memory.Storage
+	mu sync.RWMutex
+}
+
+func newLockingStorage() *lockingStorage {
+	return &lockingStorage{Storage: memory.NewStorage()}
+}
+
+func (s *lockingStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetEncodedObject(obj)
+}
+
+func (s *lockingStorage) HasEncodedObject(h plumbing.Hash) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.HasEncodedObject(h)
+}
+
+func (s *lockingStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.EncodedObjectSize(h)
+}
+
+func (s *lockingStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.EncodedObject(t, h)
+}
+
+func (s *lockingStorage) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.IterEncodedObjects(t)
+}
+
+func (s *lockingStorage) ForEachObjectHash(f func(plumbing.Hash) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.ForEachObjectHash(f)
+}
+
+func (s *lockingStorage) SetReference(ref *plumbing.Reference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetReference(ref)
+}
+
+func (s *lockingStorage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.CheckAndSetReference(ref, old)
+}
+
+func (s *lockingStorage) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.Reference(n)
+}
+
+func (s *lockingStorage) IterReferences() (storer.ReferenceIter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.IterReferences()
+}
+
+func (s *lockingStorage) RemoveReference(n plumbing.ReferenceName) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.RemoveReference(n)
+}
+
+func (s *lockingStorage) SetShallow(commits []plumbing.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetShallow(commits)
+}
+
+func (s *lockingStorage) Shallow() ([]plumbing.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.Shallow()
+}
+
+func (s *lockingStorage) SetConfig(cfg *config.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Storage.SetConfig(cfg)
+}
+
+func (s *lockingStorage) Config() (*config.Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Storage.Config()
+}
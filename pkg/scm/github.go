@@ -0,0 +1,86 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// gitHub implements Provider with the GitHub REST API.
+type gitHub struct {
+	api *api
+}
+
+func (g *gitHub) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	var result struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, "/repos/"+repo, nil, &result); err != nil {
+		return "", err
+	}
+	return result.DefaultBranch, nil
+}
+
+func (g *gitHub) CreateBranch(ctx context.Context, repo, branch, sha string) error {
+	body := map[string]string{"ref": "refs/heads/" + branch, "sha": sha}
+	return g.api.do(ctx, http.MethodPost, "/repos/"+repo+"/git/refs", body, nil)
+}
+
+func (g *gitHub) OpenPullRequest(ctx context.Context, repo string, opts PullRequestOptions) (*PullRequest, error) {
+	body := map[string]string{"title": opts.Title, "body": opts.Body, "head": opts.Head, "base": opts.Base}
+	var result struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := g.api.do(ctx, http.MethodPost, "/repos/"+repo+"/pulls", body, &result); err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: result.Number, URL: result.HTMLURL}, nil
+}
+
+func (g *gitHub) Comment(ctx context.Context, repo string, number int, body string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number)
+	return g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// Status combines the state of the pull request with the combined status of
+// its head commit, GitHub reports "pending" for commits without any statuses,
+// so these are reported as having no checks.
+func (g *gitHub) Status(ctx context.Context, repo string, number int) (*Status, error) {
+	var pr struct {
+		State  string `json:"state"`
+		Merged bool   `json:"merged"`
+		Head   struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls/%d", repo, number), nil, &pr); err != nil {
+		return nil, err
+	}
+	var combined struct {
+		State      string `json:"state"`
+		TotalCount int    `json:"total_count"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/commits/%s/status", repo, pr.Head.SHA), nil, &combined); err != nil {
+		return nil, err
+	}
+
+	s := &Status{State: StateOpen}
+	switch {
+	case pr.Merged:
+		s.State = StateMerged
+	case pr.State == "closed":
+		s.State = StateClosed
+	}
+	if combined.TotalCount > 0 {
+		switch combined.State {
+		case "success":
+			s.Checks = ChecksSuccess
+		case "failure", "error":
+			s.Checks = ChecksFailure
+		default:
+			s.Checks = ChecksPending
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,173 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGitHubDefaultBranch(t *testing.T) {
+	s := newStandIn(t, "Authorization", "Bearer test-token")
+	s.handle("GET /repos/my-org/my-repo", http.StatusOK, `{"default_branch": "main"}`)
+	p := newTestProvider(t, GitHub, s)
+
+	branch, err := p.DefaultBranch(context.Background(), "my-org/my-repo")
+	assertNoError(t, err)
+
+	if branch != "main" {
+		t.Fatalf("got branch %q, want %q", branch, "main")
+	}
+}
+
+func TestGitHubCreateBranch(t *testing.T) {
+	s := newStandIn(t, "Authorization", "Bearer test-token")
+	s.handle("POST /repos/my-org/my-repo/git/refs", http.StatusCreated, `{}`)
+	p := newTestProvider(t, GitHub, s)
+
+	err := p.CreateBranch(context.Background(), "my-org/my-repo", "promote-http", "b1a2c3")
+	assertNoError(t, err)
+
+	s.assertBody("POST /repos/my-org/my-repo/git/refs", map[string]interface{}{"ref": "refs/heads/promote-http", "sha": "b1a2c3"})
+}
+
+func TestGitHubOpenPullRequest(t *testing.T) {
+	s := newStandIn(t, "Authorization", "Bearer test-token")
+	s.handle("POST /repos/my-org/my-repo/pulls", http.StatusCreated,
+		`{"number": 12, "html_url": "https://github.com/my-org/my-repo/pull/12"}`)
+	p := newTestProvider(t, GitHub, s)
+
+	pr, err := p.OpenPullRequest(context.Background(), "my-org/my-repo", PullRequestOptions{
+		Title: "Promote http", Body: "Promotes http", Head: "promote-http", Base: "main",
+	})
+	assertNoError(t, err)
+
+	want := &PullRequest{Number: 12, URL: "https://github.com/my-org/my-repo/pull/12"}
+	if diff := cmp.Diff(want, pr); diff != "" {
+		t.Fatalf("pull request didn't match:\n%s", diff)
+	}
+	s.assertBody("POST /repos/my-org/my-repo/pulls", map[string]interface{}{
+		"title": "Promote http", "body": "Promotes http", "head": "promote-http", "base": "main",
+	})
+}
+
+func TestGitHubComment(t *testing.T) {
+	s := newStandIn(t, "Authorization", "Bearer test-token")
+	s.handle("POST /repos/my-org/my-repo/issues/12/comments", http.StatusCreated, `{}`)
+	p := newTestProvider(t, GitHub, s)
+
+	err := p.Comment(context.Background(), "my-org/my-repo", 12, "Looks good")
+	assertNoError(t, err)
+
+	s.assertBody("POST /repos/my-org/my-repo/issues/12/comments", map[string]interface{}{"body": "Looks good"})
+}
+
+func TestGitHubStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		pr     string
+		status string
+		want   *Status
+	}{
+		{"open without checks", `{"state": "open", "head": {"sha": "abc"}}`, `{"state": "pending", "total_count": 0}`, &Status{State: StateOpen}},
+		{"open with pending checks", `{"state": "open", "head": {"sha": "abc"}}`, `{"state": "pending", "total_count": 2}`, &Status{State: StateOpen, Checks: ChecksPending}},
+		{"merged", `{"state": "closed", "merged": true, "head": {"sha": "abc"}}`, `{"state": "success", "total_count": 1}`, &Status{State: StateMerged, Checks: ChecksSuccess}},
+		{"closed with errors", `{"state": "closed", "head": {"sha": "abc"}}`, `{"state": "error", "total_count": 1}`, &Status{State: StateClosed, Checks: ChecksFailure}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, "Authorization", "Bearer test-token")
+			s.handle("GET /repos/my-org/my-repo/pulls/12", http.StatusOK, tt.pr)
+			s.handle("GET /repos/my-org/my-repo/commits/abc/status", http.StatusOK, tt.status)
+			p := newTestProvider(t, GitHub, s)
+
+			status, err := p.Status(context.Background(), "my-org/my-repo", 12)
+			assertNoError(t, err)
+
+			if diff := cmp.Diff(tt.want, status); diff != "" {
+				t.Fatalf("status didn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGitHubErrorResponse(t *testing.T) {
+	s := newStandIn(t, "Authorization", "Bearer test-token")
+	s.handle("POST /repos/my-org/my-repo/pulls", http.StatusUnprocessableEntity, `{"message": "Validation Failed"}`)
+	p := newTestProvider(t, GitHub, s)
+
+	_, err := p.OpenPullRequest(context.Background(), "my-org/my-repo", PullRequestOptions{Head: "main", Base: "main"})
+
+	want := "POST /repos/my-org/my-repo/pulls failed with 422 Unprocessable Entity: Validation Failed"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+}
+
+// standIn is a local HTTP stand-in for a provider's API, it responds to the
+// requests that it's configured to handle, and records the request bodies.
+type standIn struct {
+	t      *testing.T
+	server *httptest.Server
+	routes map[string]http.HandlerFunc
+	bodies map[string]interface{}
+}
+
+// newStandIn creates a stand-in that requires the token header in each
+// request.
+func newStandIn(t *testing.T, header, value string) *standIn {
+	s := &standIn{t: t, routes: map[string]http.HandlerFunc{}, bodies: map[string]interface{}{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(header); got != value {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		h, ok := s.routes[r.Method+" "+r.URL.EscapedPath()]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// handle responds to requests to a method and escaped path, e.g.
+// "GET /projects/my-org%2Fmy-repo".
+func (s *standIn) handle(route string, status int, response string) {
+	s.routes[route] = func(w http.ResponseWriter, r *http.Request) {
+		var body interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
+			s.bodies[route] = body
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}
+}
+
+func (s *standIn) assertBody(route string, want interface{}) {
+	s.t.Helper()
+	if diff := cmp.Diff(want, s.bodies[route]); diff != "" {
+		s.t.Fatalf("request body for %s didn't match:\n%s", route, diff)
+	}
+}
+
+func newTestProvider(t *testing.T, provider string, s *standIn) Provider {
+	t.Helper()
+	p, err := New(provider, s.server.URL, "test-token", s.server.Client())
+	assertNoError(t, err)
+	return p
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+)
+
+// gitLab implements Provider with the GitLab REST API.
+type gitLab struct {
+	api *api
+}
+
+func (g *gitLab) DefaultBranch(ctx context.Context, repo string) (string, error) {
+	var result struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, projectPath(repo), nil, &result); err != nil {
+		return "", err
+	}
+	return result.DefaultBranch, nil
+}
+
+func (g *gitLab) CreateBranch(ctx context.Context, repo, branch, sha string) error {
+	body := map[string]string{"branch": branch, "ref": sha}
+	return g.api.do(ctx, http.MethodPost, projectPath(repo)+"/repository/branches", body, nil)
+}
+
+func (g *gitLab) OpenPullRequest(ctx context.Context, repo string, opts PullRequestOptions) (*PullRequest, error) {
+	body := map[string]string{
+		"title":         opts.Title,
+		"description":   opts.Body,
+		"source_branch": opts.Head,
+		"target_branch": opts.Base,
+	}
+	var result struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := g.api.do(ctx, http.MethodPost, projectPath(repo)+"/merge_requests", body, &result); err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: result.IID, URL: result.WebURL}, nil
+}
+
+func (g *gitLab) Comment(ctx context.Context, repo string, number int, body string) error {
+	path := fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(repo), number)
+	return g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// Status combines the state of the merge request with the status of its head
+// pipeline.
+func (g *gitLab) Status(ctx context.Context, repo string, number int) (*Status, error) {
+	var mr struct {
+		State        string `json:"state"`
+		HeadPipeline *struct {
+			Status string `json:"status"`
+		} `json:"head_pipeline"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", projectPath(repo), number), nil, &mr); err != nil {
+		return nil, err
+	}
+
+	s := &Status{State: StateOpen}
+	switch mr.State {
+	case "merged":
+		s.State = StateMerged
+	case "closed", "locked":
+		s.State = StateClosed
+	}
+	if mr.HeadPipeline != nil {
+		switch mr.HeadPipeline.Status {
+		case "success":
+			s.Checks = ChecksSuccess
+		case "failed", "canceled":
+			s.Checks = ChecksFailure
+		case "skipped", "":
+		default:
+			s.Checks = ChecksPending
+		}
+	}
+	return s, nil
+}
+
+// projectPath returns the API path of a project, projects are identified by
+// their URL-encoded path.
+func projectPath(repo string) string {
+	return "/projects/" + neturl.PathEscape(repo)
+}
@@ -0,0 +1,104 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGitLabDefaultBranch(t *testing.T) {
+	s := newStandIn(t, "PRIVATE-TOKEN", "test-token")
+	s.handle("GET /projects/my-group%2Fmy-repo", http.StatusOK, `{"default_branch": "main"}`)
+	p := newTestProvider(t, GitLab, s)
+
+	branch, err := p.DefaultBranch(context.Background(), "my-group/my-repo")
+	assertNoError(t, err)
+
+	if branch != "main" {
+		t.Fatalf("got branch %q, want %q", branch, "main")
+	}
+}
+
+func TestGitLabCreateBranch(t *testing.T) {
+	s := newStandIn(t, "PRIVATE-TOKEN", "test-token")
+	s.handle("POST /projects/my-group%2Fmy-repo/repository/branches", http.StatusCreated, `{}`)
+	p := newTestProvider(t, GitLab, s)
+
+	err := p.CreateBranch(context.Background(), "my-group/my-repo", "promote-http", "b1a2c3")
+	assertNoError(t, err)
+
+	s.assertBody("POST /projects/my-group%2Fmy-repo/repository/branches", map[string]interface{}{"branch": "promote-http", "ref": "b1a2c3"})
+}
+
+func TestGitLabOpenPullRequest(t *testing.T) {
+	s := newStandIn(t, "PRIVATE-TOKEN", "test-token")
+	s.handle("POST /projects/my-group%2Fsub%2Fmy-repo/merge_requests", http.StatusCreated,
+		`{"id": 1234, "iid": 7, "web_url": "https://gitlab.com/my-group/sub/my-repo/-/merge_requests/7"}`)
+	p := newTestProvider(t, GitLab, s)
+
+	pr, err := p.OpenPullRequest(context.Background(), "my-group/sub/my-repo", PullRequestOptions{
+		Title: "Promote http", Body: "Promotes http", Head: "promote-http", Base: "main",
+	})
+	assertNoError(t, err)
+
+	want := &PullRequest{Number: 7, URL: "https://gitlab.com/my-group/sub/my-repo/-/merge_requests/7"}
+	if diff := cmp.Diff(want, pr); diff != "" {
+		t.Fatalf("merge request didn't match:\n%s", diff)
+	}
+	s.assertBody("POST /projects/my-group%2Fsub%2Fmy-repo/merge_requests", map[string]interface{}{
+		"title": "Promote http", "description": "Promotes http", "source_branch": "promote-http", "target_branch": "main",
+	})
+}
+
+func TestGitLabComment(t *testing.T) {
+	s := newStandIn(t, "PRIVATE-TOKEN", "test-token")
+	s.handle("POST /projects/my-group%2Fmy-repo/merge_requests/7/notes", http.StatusCreated, `{}`)
+	p := newTestProvider(t, GitLab, s)
+
+	err := p.Comment(context.Background(), "my-group/my-repo", 7, "Looks good")
+	assertNoError(t, err)
+
+	s.assertBody("POST /projects/my-group%2Fmy-repo/merge_requests/7/notes", map[string]interface{}{"body": "Looks good"})
+}
+
+func TestGitLabStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		mr   string
+		want *Status
+	}{
+		{"opened without a pipeline", `{"state": "opened", "head_pipeline": null}`, &Status{State: StateOpen}},
+		{"opened with a running pipeline", `{"state": "opened", "head_pipeline": {"status": "running"}}`, &Status{State: StateOpen, Checks: ChecksPending}},
+		{"merged", `{"state": "merged", "head_pipeline": {"status": "success"}}`, &Status{State: StateMerged, Checks: ChecksSuccess}},
+		{"closed with a failed pipeline", `{"state": "closed", "head_pipeline": {"status": "failed"}}`, &Status{State: StateClosed, Checks: ChecksFailure}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, "PRIVATE-TOKEN", "test-token")
+			s.handle("GET /projects/my-group%2Fmy-repo/merge_requests/7", http.StatusOK, tt.mr)
+			p := newTestProvider(t, GitLab, s)
+
+			status, err := p.Status(context.Background(), "my-group/my-repo", 7)
+			assertNoError(t, err)
+
+			if diff := cmp.Diff(tt.want, status); diff != "" {
+				t.Fatalf("status didn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGitLabWithBadToken(t *testing.T) {
+	s := newStandIn(t, "PRIVATE-TOKEN", "another-token")
+	p := newTestProvider(t, GitLab, s)
+
+	_, err := p.DefaultBranch(context.Background(), "my-group/my-repo")
+
+	want := "GET /projects/my-group%2Fmy-repo failed with 401 Unauthorized: Bad credentials"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,184 @@
+// Package scm opens and tracks pull requests with the services that host Git
+// repositories, e.g. GitHub and GitLab.
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// The supported providers.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// The states of a pull request.
+const (
+	StateOpen   = "open"
+	StateClosed = "closed"
+	StateMerged = "merged"
+)
+
+// The combined states of the checks on a pull request's head commit.
+const (
+	ChecksPending = "pending"
+	ChecksSuccess = "success"
+	ChecksFailure = "failure"
+)
+
+// Provider is the API of a service that hosts repositories.
+//
+// Repositories are identified by their path on the service, e.g.
+// "my-org/my-repo", and pull requests by their number within the repository,
+// for GitLab, pull requests are merge requests.
+type Provider interface {
+	// DefaultBranch returns the name of the repository's default branch.
+	DefaultBranch(ctx context.Context, repo string) (string, error)
+	// CreateBranch creates a branch that points at a commit.
+	CreateBranch(ctx context.Context, repo, branch, sha string) error
+	// OpenPullRequest opens a pull request to merge the head branch into the
+	// base branch.
+	OpenPullRequest(ctx context.Context, repo string, opts PullRequestOptions) (*PullRequest, error)
+	// Comment adds a comment to a pull request.
+	Comment(ctx context.Context, repo string, number int, body string) error
+	// Status returns the state of a pull request and its checks.
+	Status(ctx context.Context, repo string, number int) (*Status, error)
+}
+
+// PullRequestOptions describes a pull request to open.
+type PullRequestOptions struct {
+	Title string
+	Body  string
+	Head  string // The branch with the changes.
+	Base  string // The branch to merge the changes into.
+}
+
+// PullRequest is an opened pull request.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// Status is the state of a pull request, one of "open", "closed" or
+// "merged", and the combined state of the checks on its head commit, which is
+// one of "pending", "success" or "failure", or empty if there are no checks.
+type Status struct {
+	State  string `json:"state"`
+	Checks string `json:"checks,omitempty"`
+}
+
+// New creates and returns the Provider for an API.
+//
+// The URL defaults to the public API of the provider, and the token is sent
+// with each request, the client defaults to http.DefaultClient.
+func New(provider, url, token string, client *http.Client) (Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	switch provider {
+	case GitHub:
+		if url == "" {
+			url = "https://api.github.com"
+		}
+		return &gitHub{api: newAPI(url, client, "Authorization", "Bearer "+token)}, nil
+	case GitLab:
+		if url == "" {
+			url = "https://gitlab.com/api/v4"
+		}
+		return &gitLab{api: newAPI(url, client, "PRIVATE-TOKEN", token)}, nil
+	}
+	return nil, fmt.Errorf("unknown SCM provider %q", provider)
+}
+
+// RepositoryFromURL returns the path of a repository from the URL that it's
+// cloned from, e.g. "my-org/my-repo" for both
+// "https://github.com/my-org/my-repo.git" and
+// "git@github.com:my-org/my-repo.git".
+func RepositoryFromURL(url string) (string, error) {
+	p := ""
+	if u, err := neturl.Parse(url); err == nil && u.Scheme != "" && u.Host != "" {
+		p = u.Path
+	} else if i := strings.Index(url, ":"); i > 0 && !strings.Contains(url[:i], "/") {
+		p = url[i+1:]
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	if !strings.Contains(p, "/") {
+		return "", fmt.Errorf("failed to identify the repository in %q", url)
+	}
+	return p, nil
+}
+
+// api makes JSON requests to a provider's API.
+type api struct {
+	url         string
+	client      *http.Client
+	tokenHeader string
+	token       string
+}
+
+func newAPI(url string, client *http.Client, tokenHeader, token string) *api {
+	return &api{url: strings.TrimSuffix(url, "/"), client: client, tokenHeader: tokenHeader, token: token}
+}
+
+// do sends a request with an optional JSON body to a path within the API, and
+// decodes the JSON response into the result, unless it's nil.
+//
+// Responses that aren't successful are returned as errors, along with the
+// message from the response.
+func (a *api) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(a.tokenHeader, a.token)
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s %s failed with %s: %s", method, path, res.Status, errorMessage(res.Body))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode the response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// errorMessage returns the message from an error response, both GitHub and
+// GitLab return a JSON object with a "message".
+func errorMessage(r io.Reader) string {
+	b, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return err.Error()
+	}
+	var v struct {
+		Message interface{} `json:"message"`
+	}
+	if err := json.Unmarshal(b, &v); err == nil && v.Message != nil {
+		return fmt.Sprint(v.Message)
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,44 @@
+package scm
+
+import (
+	"testing"
+)
+
+func TestRepositoryFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/my-org/my-repo.git", "my-org/my-repo"},
+		{"https://github.com/my-org/my-repo", "my-org/my-repo"},
+		{"https://gitlab.example.com/my-group/sub/my-repo.git", "my-group/sub/my-repo"},
+		{"git@github.com:my-org/my-repo.git", "my-org/my-repo"},
+		{"ssh://git@gitlab.com/my-group/my-repo.git", "my-group/my-repo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := RepositoryFromURL(tt.url)
+			assertNoError(t, err)
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryFromURLWithUnknownRepository(t *testing.T) {
+	for _, u := range []string{"https://github.com/", "https://github.com/my-repo.git", "my-repo"} {
+		if _, err := RepositoryFromURL(u); err == nil {
+			t.Errorf("expected an error for %q", u)
+		}
+	}
+}
+
+func TestNewWithUnknownProvider(t *testing.T) {
+	_, err := New("bitbucket", "", "", nil)
+
+	if err == nil || err.Error() != `unknown SCM provider "bitbucket"` {
+		t.Fatalf("got error %v", err)
+	}
+}